@@ -0,0 +1,105 @@
+package imgrid
+
+import (
+	"image"
+	"image/color"
+)
+
+// drawAxes draws the X and Y axes of a width x height grid onto overlay for Config.DrawAxes:
+// a line through AxesOrigin along each axis with an arrowhead at its positive end, the right
+// edge for X and the top edge for Y, labeled "X" and "Y" like the cell numbers. An axis whose
+// line lies outside the grid is left out. Lines and arrowheads are collected in one mask so
+// that the crossing is not drawn twice.
+func drawAxes(overlay *image.RGBA, width, height int, config Config) {
+	axesColor := config.AxesColor
+	if axesColor == nil {
+		axesColor = opaque(config.GridColor)
+	}
+
+	origin := config.AxesOrigin
+	lineWidth := max(config.LineWidth, 1)
+	head := 4*lineWidth + 4
+
+	// Thick axes extend from their position like the grid lines do, so the arrowheads are
+	// centered on the band of pixels the lines cover
+	lineStart := lineLead(config)
+	center := float64(lineWidth)/2 - float64(lineStart)
+
+	axes := image.NewAlpha(overlay.Bounds())
+	hasX := origin.Y >= 0 && origin.Y < height
+	hasY := origin.X >= 0 && origin.X < width
+	if hasX {
+		markSegment(axes, 0, origin.Y, width-1-head, origin.Y, config)
+		y := float64(origin.Y) + center
+		fillTriangle(axes, float64(width), y, float64(width-head), y-float64(head)/2, float64(width-head), y+float64(head)/2)
+	}
+	if hasY {
+		markSegment(axes, origin.X, height-1, origin.X, head, config)
+		x := float64(origin.X) + center
+		fillTriangle(axes, x, 0, x-float64(head)/2, float64(head), x+float64(head)/2, float64(head))
+	}
+	compositeMask(overlay, axes, axesColor)
+
+	// Label each arrowhead on the side away from the other axis, or on the other side when
+	// that would leave the grid
+	labelWidth, labelHeight := MeasureLabel("X", config)
+	gap := head/2 + 2
+	if hasX {
+		x := width - labelWidth/2 - 1
+		y := origin.Y - lineStart + lineWidth + gap + labelHeight/2
+		if y+(labelHeight+1)/2 > height {
+			y = origin.Y - lineStart - gap - (labelHeight+1)/2
+		}
+		DrawLabel(overlay, x, y, "X", config)
+	}
+	if hasY {
+		x := origin.X - lineStart + lineWidth + gap + labelWidth/2
+		if x+(labelWidth+1)/2 > width {
+			x = origin.X - lineStart - gap - (labelWidth+1)/2
+		}
+		DrawLabel(overlay, x, labelHeight/2+1, "Y", config)
+	}
+}
+
+// fillTriangle marks the pixels of mask whose centers lie inside the triangle with the given
+// corners.
+func fillTriangle(mask *image.Alpha, x0, y0, x1, y1, x2, y2 float64) {
+	edge := func(ax, ay, bx, by, px, py float64) float64 {
+		return (bx-ax)*(py-ay) - (by-ay)*(px-ax)
+	}
+	area := edge(x0, y0, x1, y1, x2, y2)
+	if area == 0 {
+		return
+	}
+
+	bounds := image.Rect(
+		int(min(x0, x1, x2)), int(min(y0, y1, y2)),
+		int(max(x0, x1, x2))+1, int(max(y0, y1, y2))+1,
+	).Intersect(mask.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			w0 := edge(x1, y1, x2, y2, px, py) / area
+			w1 := edge(x2, y2, x0, y0, px, py) / area
+			w2 := edge(x0, y0, x1, y1, px, py) / area
+			if w0 >= 0 && w1 >= 0 && w2 >= 0 {
+				mask.SetAlpha(x, y, color.Alpha{255})
+			}
+		}
+	}
+}
+
+// opaque returns c with full opacity.
+func opaque(c color.Color) color.Color {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return color.Black
+	}
+	// Undo the premultiplication
+	return color.RGBA64{
+		R: uint16(min(r*0xffff/a, 0xffff)),
+		G: uint16(min(g*0xffff/a, 0xffff)),
+		B: uint16(min(b*0xffff/a, 0xffff)),
+		A: 0xffff,
+	}
+}
@@ -0,0 +1,42 @@
+package imgrid
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+)
+
+// ParseHexColor parses a CSS-style hex color in the form #RGB, #RRGGBB or #RRGGBBAA.
+// The alpha component is straight (not premultiplied), so "#00FFFF64" is cyan at roughly
+// 40% opacity. Colors without an alpha component are opaque.
+func ParseHexColor(s string) (color.Color, error) {
+	if len(s) == 0 || s[0] != '#' {
+		return nil, fmt.Errorf("invalid hex color %q: missing leading '#'", s)
+	}
+
+	hex := s[1:]
+	switch len(hex) {
+	case 3:
+		// Expand #RGB to #RRGGBB
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	case 6, 8:
+	default:
+		return nil, fmt.Errorf("invalid hex color %q: expected #RGB, #RRGGBB or #RRGGBBAA", s)
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex color %q: %v", s, err)
+	}
+
+	if len(hex) == 6 {
+		value = value<<8 | 0xff
+	}
+
+	return color.NRGBA{
+		R: uint8(value >> 24),
+		G: uint8(value >> 16),
+		B: uint8(value >> 8),
+		A: uint8(value),
+	}, nil
+}
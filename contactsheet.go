@@ -0,0 +1,118 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// CellContactSheet extracts every cellSize x cellSize cell of img, numbered as AddGrid numbers
+// them, and arranges the cells on a single sheet for inspecting a dataset at a glance. Each cell
+// is scaled by the same factor to fit a config.CellSize tile, so partial edge cells keep their
+// proportions, and the tiles are laid out in numbering order in a near-square grid. The sheet is
+// then gridded with config, labeling each tile with the number of the cell it shows; the
+// remaining space is filled with CanvasColor. Returns the sheet as PNG bytes.
+func CellContactSheet(img image.Image, cellSize int, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if cellSize <= 0 {
+		return nil, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	src := copyImage(img)
+	bounds := src.Bounds()
+	columns, rows := gridDimensions(bounds.Max.X, bounds.Max.Y, cellSize)
+	cells := columns * rows
+	if cells == 0 {
+		return nil, fmt.Errorf("image has no cells")
+	}
+
+	tile := config.CellSize
+	sheetColumns := int(math.Ceil(math.Sqrt(float64(cells))))
+	sheetRows := (cells + sheetColumns - 1) / sheetColumns
+	sheet := image.NewRGBA(image.Rect(0, 0, sheetColumns*tile, sheetRows*tile))
+	if config.CanvasColor != nil {
+		draw.Draw(sheet, sheet.Bounds(), image.NewUniform(config.CanvasColor), image.Point{}, draw.Src)
+	}
+
+	labels := make([]string, sheetColumns*sheetRows)
+	for i := 0; i < cells; i++ {
+		cell, err := cellRect(i, bounds, cellSize, config.Origin(), false)
+		if err != nil {
+			return nil, err
+		}
+
+		col, row := cellPosition(i, sheetColumns, sheetRows, config.Origin())
+		origin := image.Pt(col*tile, row*tile)
+		scaleCell(sheet, origin, src, cell, float64(tile)/float64(cellSize))
+		labels[i] = CellLabel(i, i%columns, i/columns, config)
+	}
+
+	// Tiles past the last cell stay unlabeled
+	return encodeImage(renderGrid(sheet, config, labels), config)
+}
+
+// scaleCell draws the cell region of src onto dst with its top-left corner at origin, scaled
+// by scale. Each destination pixel is the average of the source pixels it covers, which is a
+// box filter when shrinking and nearest-neighbor sampling when enlarging.
+func scaleCell(dst *image.RGBA, origin image.Point, src *image.RGBA, cell image.Rectangle, scale float64) {
+	width := int(math.Round(float64(cell.Dx()) * scale))
+	height := int(math.Round(float64(cell.Dy()) * scale))
+
+	for dy := 0; dy < height; dy++ {
+		y0 := cell.Min.Y + int(float64(dy)/scale)
+		y1 := cell.Min.Y + int(float64(dy+1)/scale)
+		y0, y1 = sampleSpan(y0, y1, cell.Max.Y)
+
+		for dx := 0; dx < width; dx++ {
+			x0 := cell.Min.X + int(float64(dx)/scale)
+			x1 := cell.Min.X + int(float64(dx+1)/scale)
+			x0, x1 = sampleSpan(x0, x1, cell.Max.X)
+
+			var r, g, b, a, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := src.PixOffset(x, y)
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+
+			dst.SetRGBA(origin.X+dx, origin.Y+dy, color.RGBA{
+				R: uint8(r / n),
+				G: uint8(g / n),
+				B: uint8(b / n),
+				A: uint8(a / n),
+			})
+		}
+	}
+}
+
+// sampleSpan clamps the source span [lo, hi) to end before limit and makes it cover at least
+// one pixel.
+func sampleSpan(lo, hi, limit int) (int, int) {
+	if lo >= limit {
+		lo = limit - 1
+	}
+	if hi > limit {
+		hi = limit
+	}
+	if hi <= lo {
+		hi = lo + 1
+	}
+
+	return lo, hi
+}
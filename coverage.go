@@ -0,0 +1,34 @@
+package imgrid
+
+import "image"
+
+// AddGridWithCoverage overlays a grid like AddGrid and also returns the overlay's coverage: an
+// 8-bit grayscale PNG of the same size holding the opacity of everything drawn over the source,
+// from 0 where the source shows through unchanged to 255 where a line, number background or
+// glyph covers it fully. Editors can use it to weaken or strengthen the grid afterwards by
+// remultiplying. The coverage is measured by drawing the grid a second time on a transparent
+// canvas, so CanvasColor, which fills behind the source, is not part of it.
+func AddGridWithCoverage(img image.Image, config Config) (composited []byte, coverage []byte, err error) {
+	composited, err = AddGrid(img, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config = config.Normalize()
+	config.CanvasColor = nil
+	config.Hooks = nil
+	overlay := renderGrid(image.NewRGBA(img.Bounds()), config, nil)
+
+	mask := image.NewGray(overlay.Bounds())
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		for x := mask.Rect.Min.X; x < mask.Rect.Max.X; x++ {
+			mask.Pix[mask.PixOffset(x, y)] = overlay.Pix[overlay.PixOffset(x, y)+3]
+		}
+	}
+
+	if coverage, err = encodeImage(mask, config); err != nil {
+		return nil, nil, err
+	}
+
+	return composited, coverage, nil
+}
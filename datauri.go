@@ -0,0 +1,38 @@
+package imgrid
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+)
+
+// AddGridDataURI overlays a grid like AddGrid and returns the result as a base64 data URI
+// ("data:image/png;base64,..."), ready to embed in HTML or JSON. With a custom Encoder, the
+// MIME type is detected from the encoded bytes.
+func AddGridDataURI(img image.Image, config Config) (string, error) {
+	data, err := AddGrid(img, config)
+	if err != nil {
+		return "", err
+	}
+
+	return "data:" + imageMIMEType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// imageMIMEType returns the MIME type of encoded image data based on its signature, falling
+// back to application/octet-stream for unknown formats.
+func imageMIMEType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "image/bmp"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	}
+
+	return "application/octet-stream"
+}
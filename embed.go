@@ -0,0 +1,149 @@
+package imgrid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+)
+
+// configChunkKey is the keyword of the PNG tEXt chunk that holds an embedded Config.
+const configChunkKey = "imgrid-config"
+
+// sourceChunkType is the type of the PNG chunk that holds the source image stored with
+// KeepSource. The lowercase first two letters mark it ancillary and private, so decoders that
+// do not know it skip it; the uppercase last letter marks it unsafe to copy, so editors drop it
+// when they change the image.
+const sourceChunkType = "orIG"
+
+// pngSignature is the 8-byte header every PNG file starts with.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// embedConfig inserts a tEXt chunk holding the JSON-encoded config into PNG data, right after
+// the IHDR chunk.
+func embedConfig(data []byte, config Config) ([]byte, error) {
+	text, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %v", err)
+	}
+
+	// The image header is always the first chunk and has a fixed 13-byte payload
+	headerEnd := len(pngSignature) + 8 + 13 + 4
+	if len(data) < headerEnd || !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("invalid PNG data")
+	}
+
+	return insertChunk(data, headerEnd, "tEXt", append([]byte(configChunkKey+"\x00"), text...)), nil
+}
+
+// embedSource stores src, encoded as PNG, in a chunk of the gridded PNG data when KeepSource
+// is set, so RemoveGrid can restore it. Use encodeGridded rather than calling it directly. The
+// chunk goes right before the IEND chunk, after the image data, so viewers can show the grid
+// before the source has loaded. Output of a custom Encoder is returned unchanged.
+func embedSource(data []byte, src image.Image, config Config) ([]byte, error) {
+	if !config.KeepSource || config.Encoder != nil {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: config.PNGCompression}
+	if err := encoder.Encode(&buf, src); err != nil {
+		return nil, fmt.Errorf("failed to encode source image: %v", err)
+	}
+
+	// IEND is always the last chunk and has no payload
+	end := len(data) - 12
+	if end < len(pngSignature) || !bytes.HasPrefix(data, pngSignature) || string(data[end+4:end+8]) != "IEND" {
+		return nil, fmt.Errorf("invalid PNG data")
+	}
+
+	return insertChunk(data, end, sourceChunkType, buf.Bytes()), nil
+}
+
+// insertChunk returns a copy of the PNG data with a chunk of the given type and payload
+// inserted at offset, which must be a chunk boundary.
+func insertChunk(data []byte, offset int, kind string, payload []byte) []byte {
+	chunk := make([]byte, 0, 12+len(payload))
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := make([]byte, 0, len(data)+len(chunk))
+	out = append(out, data[:offset]...)
+	out = append(out, chunk...)
+	out = append(out, data[offset:]...)
+	return out
+}
+
+// findChunk returns the payload of the first chunk in the PNG data for which match returns
+// true, or nil if there is none.
+func findChunk(pngData []byte, match func(kind string, payload []byte) bool) ([]byte, error) {
+	if !bytes.HasPrefix(pngData, pngSignature) {
+		return nil, fmt.Errorf("invalid PNG data")
+	}
+
+	for rest := pngData[len(pngSignature):]; len(rest) >= 12; {
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length) > uint64(len(rest)-12) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		kind, payload := string(rest[4:8]), rest[8:8+length]
+		rest = rest[12+length:]
+
+		if kind == "IEND" {
+			break
+		}
+		if match(kind, payload) {
+			return payload, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ReadConfig returns the configuration embedded in PNG data produced with EmbedConfig set,
+// so a grid can be recreated or adjusted from a previously generated image. Fields that were
+// not serialized, such as Encoder, are left zero.
+func ReadConfig(pngData []byte) (Config, error) {
+	prefix := []byte(configChunkKey + "\x00")
+	payload, err := findChunk(pngData, func(kind string, payload []byte) bool {
+		return kind == "tEXt" && bytes.HasPrefix(payload, prefix)
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	if payload == nil {
+		return Config{}, fmt.Errorf("no embedded config found")
+	}
+
+	var config Config
+	if err := json.Unmarshal(payload[len(prefix):], &config); err != nil {
+		return Config{}, fmt.Errorf("invalid embedded config: %v", err)
+	}
+	return config, nil
+}
+
+// RemoveGrid returns the source image stored in PNG data produced with KeepSource set, as PNG
+// bytes, undoing the grid. The source is stored as it was passed in, before CanvasPad,
+// CanvasColor or Rotate were applied. Returns an error if the data is not a PNG or
+// carries no source, e.g. because an editor dropped the chunk when modifying the image.
+func RemoveGrid(pngData []byte) ([]byte, error) {
+	source, err := findChunk(pngData, func(kind string, payload []byte) bool {
+		return kind == sourceChunkType
+	})
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("no stored source image found")
+	}
+	if !bytes.HasPrefix(source, pngSignature) {
+		return nil, fmt.Errorf("invalid stored source image")
+	}
+
+	return bytes.Clone(source), nil
+}
@@ -0,0 +1,13 @@
+package imgrid
+
+import "errors"
+
+// Errors returned by the cell coordinate functions. They are wrapped with the
+// offending cell number, so use errors.Is to check for them.
+var (
+	// ErrNegativeCell is returned when a cell number is below zero.
+	ErrNegativeCell = errors.New("negative cell number")
+
+	// ErrCellOutOfRange is returned when a cell number lies beyond the last cell of the grid.
+	ErrCellOutOfRange = errors.New("cell number out of range")
+)
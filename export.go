@@ -0,0 +1,143 @@
+package imgrid
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"strconv"
+)
+
+// CellBounds returns the pixel bounds of a cell on a width x height image, numbered as drawn
+// by AddGrid from the default TopLeft origin without MergePartialCells (including partial
+// cells at the right and bottom edges). Partial cells are clipped to the image. Max is
+// exclusive, following image.Rectangle.
+func CellBounds(cellNumber int, width, height int, cellSize int) (image.Rectangle, error) {
+	if cellSize <= 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	return cellRect(cellNumber, image.Rect(0, 0, width, height), cellSize, TopLeft, false)
+}
+
+// GridCSV returns the cell-to-pixel mapping of a width x height grid as CSV, one row per cell in
+// row-major order after a header row: cell,col,row,centerX,centerY,minX,minY,maxX,maxY.
+// The center is the center of the cell's bounds as returned by CellBounds, and maxX/maxY are
+// exclusive.
+func GridCSV(width, height int, cellSize int) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+	if cellSize <= 0 {
+		return nil, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"cell", "col", "row", "centerX", "centerY", "minX", "minY", "maxX", "maxY"})
+
+	columns, rows := gridDimensions(width, height, cellSize)
+	for cell := 0; cell < columns*rows; cell++ {
+		r, err := CellBounds(cell, width, height, cellSize)
+		if err != nil {
+			return nil, err
+		}
+
+		record := []int{
+			cell, cell % columns, cell / columns,
+			(r.Min.X + r.Max.X) / 2, (r.Min.Y + r.Max.Y) / 2,
+			r.Min.X, r.Min.Y, r.Max.X, r.Max.Y,
+		}
+		fields := make([]string, len(record))
+		for i, v := range record {
+			fields[i] = strconv.Itoa(v)
+		}
+		w.Write(fields)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write grid CSV: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// geoJSONFeature is a cell polygon in the FeatureCollection written by GridGeoJSON.
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoJSONPolygon `json:"geometry"`
+	Properties map[string]int `json:"properties"`
+}
+
+// geoJSONPolygon is a GeoJSON Polygon geometry with a single exterior ring.
+type geoJSONPolygon struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// GridGeoJSON returns the cells of a width x height grid as a GeoJSON FeatureCollection for GIS
+// tools, one Polygon feature per cell in row-major order with the cell number, column and row
+// as "cell", "col" and "row" properties. The cell corners, as returned by CellBounds, are mapped
+// to longitude and latitude by transform, e.g. from the georeference of the imagery. Rings are
+// closed and wound counterclockwise after the transform, as RFC 7946 requires; transform should
+// preserve the cells' shapes well enough that their corners stay in order.
+func GridGeoJSON(width, height, cellSize int, transform func(px, py int) (lon, lat float64)) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+	if cellSize <= 0 {
+		return nil, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+	if transform == nil {
+		return nil, fmt.Errorf("transform must not be nil")
+	}
+
+	columns, rows := gridDimensions(width, height, cellSize)
+	features := make([]geoJSONFeature, 0, columns*rows)
+	for cell := 0; cell < columns*rows; cell++ {
+		r, err := CellBounds(cell, width, height, cellSize)
+		if err != nil {
+			return nil, err
+		}
+
+		corners := []image.Point{r.Min, {r.Min.X, r.Max.Y}, r.Max, {r.Max.X, r.Min.Y}}
+		ring := make([][2]float64, 0, len(corners)+1)
+		for _, p := range corners {
+			lon, lat := transform(p.X, p.Y)
+			ring = append(ring, [2]float64{lon, lat})
+		}
+		if signedArea(ring) < 0 {
+			ring[1], ring[3] = ring[3], ring[1]
+		}
+		ring = append(ring, ring[0])
+
+		features = append(features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONPolygon{Type: "Polygon", Coordinates: [][][2]float64{ring}},
+			Properties: map[string]int{"cell": cell, "col": cell % columns, "row": cell / columns},
+		})
+	}
+
+	data, err := json.Marshal(struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{"FeatureCollection", features})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write grid GeoJSON: %v", err)
+	}
+
+	return data, nil
+}
+
+// signedArea returns twice the signed area of the polygon with the given vertices, positive
+// when they run counterclockwise with y pointing up.
+func signedArea(ring [][2]float64) float64 {
+	var area float64
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		area += p[0]*q[1] - q[0]*p[1]
+	}
+	return area
+}
@@ -0,0 +1,436 @@
+package imgrid
+
+import "unicode"
+
+// glyphPatterns holds the 5x7 bitmap font used for labels: digits 0-9, the numeric
+// punctuation '-', '+', '.', ',' and ':', the label symbols '#', '(', ')', '[' and ']', and the
+// uppercase letters A-Z.
+var glyphPatterns = map[rune][]string{
+	'0': {
+		" ### ",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		" ### ",
+	},
+	'1': {
+		"  #  ",
+		" ##  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"#####",
+	},
+	'2': {
+		" ### ",
+		"#   #",
+		"    #",
+		"   # ",
+		"  #  ",
+		" #   ",
+		"#####",
+	},
+	'3': {
+		" ### ",
+		"#   #",
+		"    #",
+		"  ## ",
+		"    #",
+		"#   #",
+		" ### ",
+	},
+	'4': {
+		"   # ",
+		"  ## ",
+		" # # ",
+		"#  # ",
+		"#####",
+		"   # ",
+		"   # ",
+	},
+	'5': {
+		"#####",
+		"#    ",
+		"#    ",
+		"#### ",
+		"    #",
+		"#   #",
+		" ### ",
+	},
+	'6': {
+		" ### ",
+		"#   #",
+		"#    ",
+		"#### ",
+		"#   #",
+		"#   #",
+		" ### ",
+	},
+	'7': {
+		"#####",
+		"    #",
+		"   # ",
+		"  #  ",
+		" #   ",
+		" #   ",
+		" #   ",
+	},
+	'8': {
+		" ### ",
+		"#   #",
+		"#   #",
+		" ### ",
+		"#   #",
+		"#   #",
+		" ### ",
+	},
+	'9': {
+		" ### ",
+		"#   #",
+		"#   #",
+		" ####",
+		"    #",
+		"#   #",
+		" ### ",
+	},
+	'-': {
+		"     ",
+		"     ",
+		"     ",
+		"#####",
+		"     ",
+		"     ",
+		"     ",
+	},
+	'+': {
+		"     ",
+		"  #  ",
+		"  #  ",
+		"#####",
+		"  #  ",
+		"  #  ",
+		"     ",
+	},
+	'.': {
+		"     ",
+		"     ",
+		"     ",
+		"     ",
+		"     ",
+		" ##  ",
+		" ##  ",
+	},
+	',': {
+		"     ",
+		"     ",
+		"     ",
+		"     ",
+		" ##  ",
+		"  #  ",
+		" #   ",
+	},
+	':': {
+		"     ",
+		" ##  ",
+		" ##  ",
+		"     ",
+		" ##  ",
+		" ##  ",
+		"     ",
+	},
+	'#': {
+		" # # ",
+		" # # ",
+		"#####",
+		" # # ",
+		"#####",
+		" # # ",
+		" # # ",
+	},
+	'(': {
+		"   # ",
+		"  #  ",
+		" #   ",
+		" #   ",
+		" #   ",
+		"  #  ",
+		"   # ",
+	},
+	')': {
+		" #   ",
+		"  #  ",
+		"   # ",
+		"   # ",
+		"   # ",
+		"  #  ",
+		" #   ",
+	},
+	'[': {
+		" ### ",
+		" #   ",
+		" #   ",
+		" #   ",
+		" #   ",
+		" #   ",
+		" ### ",
+	},
+	']': {
+		" ### ",
+		"   # ",
+		"   # ",
+		"   # ",
+		"   # ",
+		"   # ",
+		" ### ",
+	},
+	'A': {
+		" ### ",
+		"#   #",
+		"#   #",
+		"#####",
+		"#   #",
+		"#   #",
+		"#   #",
+	},
+	'B': {
+		"#### ",
+		"#   #",
+		"#   #",
+		"#### ",
+		"#   #",
+		"#   #",
+		"#### ",
+	},
+	'C': {
+		" ### ",
+		"#   #",
+		"#    ",
+		"#    ",
+		"#    ",
+		"#   #",
+		" ### ",
+	},
+	'D': {
+		"#### ",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#### ",
+	},
+	'E': {
+		"#####",
+		"#    ",
+		"#    ",
+		"#### ",
+		"#    ",
+		"#    ",
+		"#####",
+	},
+	'F': {
+		"#####",
+		"#    ",
+		"#    ",
+		"#### ",
+		"#    ",
+		"#    ",
+		"#    ",
+	},
+	'G': {
+		" ### ",
+		"#   #",
+		"#    ",
+		"# ###",
+		"#   #",
+		"#   #",
+		" ####",
+	},
+	'H': {
+		"#   #",
+		"#   #",
+		"#   #",
+		"#####",
+		"#   #",
+		"#   #",
+		"#   #",
+	},
+	'I': {
+		" ### ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		" ### ",
+	},
+	'J': {
+		"  ###",
+		"   # ",
+		"   # ",
+		"   # ",
+		"   # ",
+		"#  # ",
+		" ##  ",
+	},
+	'K': {
+		"#   #",
+		"#  # ",
+		"# #  ",
+		"##   ",
+		"# #  ",
+		"#  # ",
+		"#   #",
+	},
+	'L': {
+		"#    ",
+		"#    ",
+		"#    ",
+		"#    ",
+		"#    ",
+		"#    ",
+		"#####",
+	},
+	'M': {
+		"#   #",
+		"## ##",
+		"# # #",
+		"# # #",
+		"#   #",
+		"#   #",
+		"#   #",
+	},
+	'N': {
+		"#   #",
+		"#   #",
+		"##  #",
+		"# # #",
+		"#  ##",
+		"#   #",
+		"#   #",
+	},
+	'O': {
+		" ### ",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		" ### ",
+	},
+	'P': {
+		"#### ",
+		"#   #",
+		"#   #",
+		"#### ",
+		"#    ",
+		"#    ",
+		"#    ",
+	},
+	'Q': {
+		" ### ",
+		"#   #",
+		"#   #",
+		"#   #",
+		"# # #",
+		"#  # ",
+		" ## #",
+	},
+	'R': {
+		"#### ",
+		"#   #",
+		"#   #",
+		"#### ",
+		"# #  ",
+		"#  # ",
+		"#   #",
+	},
+	'S': {
+		" ####",
+		"#    ",
+		"#    ",
+		" ### ",
+		"    #",
+		"    #",
+		"#### ",
+	},
+	'T': {
+		"#####",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+	},
+	'U': {
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		" ### ",
+	},
+	'V': {
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		"#   #",
+		" # # ",
+		"  #  ",
+	},
+	'W': {
+		"#   #",
+		"#   #",
+		"#   #",
+		"# # #",
+		"# # #",
+		"# # #",
+		" # # ",
+	},
+	'X': {
+		"#   #",
+		"#   #",
+		" # # ",
+		"  #  ",
+		" # # ",
+		"#   #",
+		"#   #",
+	},
+	'Y': {
+		"#   #",
+		"#   #",
+		" # # ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+		"  #  ",
+	},
+	'Z': {
+		"#####",
+		"    #",
+		"   # ",
+		"  #  ",
+		" #   ",
+		"#    ",
+		"#####",
+	},
+}
+
+// getDigitPattern returns the 5x7 bitmap pattern for a label character. Lowercase letters
+// use their uppercase glyph. Every glyph occupies a full cell, so labels are sized the
+// same regardless of which characters they contain.
+func getDigitPattern(digit rune) []string {
+	if pattern, ok := glyphPatterns[digit]; ok {
+		return pattern
+	}
+	if pattern, ok := glyphPatterns[unicode.ToUpper(digit)]; ok {
+		return pattern
+	}
+	return []string{} // Return empty pattern for unknown characters
+}
@@ -0,0 +1,143 @@
+package imgrid
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+)
+
+// gifPalette is the palette of the frames written by AddGridAnimatedGIF: the Plan 9 palette
+// with its second entry, a dark blue close to the third, replaced by transparent so that
+// transparent regions of the source survive re-encoding.
+var gifPalette = func() color.Palette {
+	p := append(color.Palette(nil), palette.Plan9...)
+	p[1] = color.Transparent
+	return p
+}()
+
+// AddGridSweepGIF renders an animated GIF that highlights one cell per frame over the gridded
+// image, for guided walkthroughs of an image's regions. Cells are visited in the given order,
+// or 0..N-1 when order is empty; each frame composites fill over the cell like HighlightCell
+// (honoring HighlightInset and HighlightRounded). delayCs is the delay per frame in hundredths
+// of a second. Frames are rotated like in AddGrid when Rotate is set, then quantized to the
+// Plan 9 palette with Floyd-Steinberg dithering.
+func AddGridSweepGIF(img image.Image, order []int, fill color.Color, delayCs int, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if fill == nil {
+		return nil, fmt.Errorf("fill color must not be nil")
+	}
+	if delayCs < 0 {
+		return nil, fmt.Errorf("invalid frame delay: %d", delayCs)
+	}
+
+	base := newCanvas(img, config)
+	bounds := base.Bounds()
+
+	if len(order) == 0 {
+		columns, rows := numberedDimensions(bounds.Max.X, bounds.Max.Y, config)
+		order = make([]int, columns*rows)
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	anim := &gif.GIF{}
+	frame := image.NewRGBA(bounds)
+	for _, cellNumber := range order {
+		cell, err := cellRect(cellNumber, bounds, config.CellSize, config.Origin(), config.MergePartialCells)
+		if err != nil {
+			return nil, err
+		}
+
+		copy(frame.Pix, base.Pix)
+		fillHighlight(frame, cell, fill, config)
+		gridded := drawRotatedGrid(frame, config, nil)
+
+		paletted := image.NewPaletted(gridded.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, gridded.Bounds(), gridded, gridded.Bounds().Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delayCs)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("failed to encode sweep GIF: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// AddGridAnimatedGIF overlays a numbered grid on every frame of an animated GIF, so animations
+// stay animated after gridding. Frames are composited as a viewer would show them, honoring
+// their offsets and disposal methods, and the grid is drawn over each full composited frame
+// like AddGrid. The frames are then quantized to the Plan 9 palette with Floyd-Steinberg
+// dithering, keeping fully transparent pixels transparent, and re-encoded with the original
+// delays and loop count. Returns the animation as GIF bytes.
+func AddGridAnimatedGIF(data []byte, config Config) ([]byte, error) {
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF: %v", err)
+	}
+	if len(src.Image) == 0 {
+		return nil, fmt.Errorf("GIF has no frames")
+	}
+	if src.Config.Width <= 0 || src.Config.Height <= 0 {
+		return nil, fmt.Errorf("invalid image size: %dx%d", src.Config.Width, src.Config.Height)
+	}
+
+	anim := &gif.GIF{LoopCount: src.LoopCount}
+	canvas := image.NewRGBA(image.Rect(0, 0, src.Config.Width, src.Config.Height))
+	var previous *image.RGBA
+	for i, frame := range src.Image {
+		var disposal byte
+		if i < len(src.Disposal) {
+			disposal = src.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		gridded := renderGrid(canvas, config, nil)
+
+		bounds := gridded.Bounds()
+		paletted := image.NewPaletted(bounds, gifPalette)
+		draw.FloydSteinberg.Draw(paletted, bounds, gridded, bounds.Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, src.Delay[i])
+
+		// Every output frame is complete, so clear it before drawing the next one to keep
+		// transparent regions from showing the previous frame
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("failed to encode animated GIF: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package imgrid
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"unicode"
+)
+
+// glyphKey identifies a rasterized glyph. The label color is applied when the glyph is
+// composited, so it is not part of the key.
+type glyphKey struct {
+	char   rune
+	scale  int
+	weight int
+}
+
+// glyphCache holds rasterized glyph masks across calls, keyed by glyphKey. It is safe for
+// concurrent use.
+var glyphCache sync.Map
+
+// ClearGlyphCache releases all cached glyph masks.
+//
+// Labels are drawn from glyph masks that are rasterized once per character, NumberScale and
+// NumberWeight and then kept for the lifetime of the process, so batches of renders with the
+// same settings skip the rasterization. Only characters with a glyph are cached, so the cache
+// holds at most one mask per glyph for each scale and weight in use; a mask takes
+// (5*scale+2*weight) x (7*scale+2*weight) bytes, about 1 KB at the default scale. Services that
+// render with many different scales or weights can bound the memory by calling ClearGlyphCache
+// periodically, and tests can call it to start from a cold cache.
+func ClearGlyphCache() {
+	glyphCache.Range(func(key, _ any) bool {
+		glyphCache.Delete(key)
+		return true
+	})
+}
+
+// glyphMask returns the mask of char drawn with the given scale and weight. The glyph's
+// top-left corner is at the origin, so with a weight the mask extends weight pixels beyond it
+// on every side. Returns nil for characters without a glyph, which are drawn as blank space.
+func glyphMask(char rune, scale, weight int) *image.Alpha {
+	if _, ok := glyphPatterns[char]; !ok {
+		char = unicode.ToUpper(char)
+		if _, ok := glyphPatterns[char]; !ok {
+			return nil
+		}
+	}
+
+	key := glyphKey{char: char, scale: scale, weight: weight}
+	if mask, ok := glyphCache.Load(key); ok {
+		return mask.(*image.Alpha)
+	}
+
+	// Mark a scaled block for each '#'
+	mask := image.NewAlpha(image.Rect(0, 0, 5*scale, 7*scale).Inset(-weight))
+	for row, line := range getDigitPattern(char) {
+		for col, c := range line {
+			if c == '#' {
+				block := image.Rect(col*scale, row*scale, (col+1)*scale, (row+1)*scale)
+				for py := block.Min.Y; py < block.Max.Y; py++ {
+					for px := block.Min.X; px < block.Max.X; px++ {
+						mask.SetAlpha(px, py, color.Alpha{A: 0xff})
+					}
+				}
+			}
+		}
+	}
+	if weight > 0 {
+		mask = dilate(mask, weight)
+	}
+
+	// Concurrent callers may rasterize the same glyph; all of them use the first one stored
+	stored, _ := glyphCache.LoadOrStore(key, mask)
+	return stored.(*image.Alpha)
+}
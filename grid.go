@@ -0,0 +1,37 @@
+package imgrid
+
+import (
+	"image"
+	"io"
+)
+
+// Grid is a lazily rendered grid overlay. The grid is drawn and encoded
+// only when WriteTo is called, so a Grid can be handed to anything that
+// accepts an io.WriterTo, such as an http.ResponseWriter via io.Copy.
+type Grid struct {
+	img    image.Image
+	config Config
+}
+
+// NewGrid returns a Grid that overlays img with a grid using the given configuration.
+func NewGrid(img image.Image, config Config) *Grid {
+	return &Grid{img: img, config: config}
+}
+
+// WriteTo renders the grid and writes it to w, producing the same bytes as AddGrid.
+// It implements io.WriterTo.
+// Each call renders the grid again from the source image.
+func (g *Grid) WriteTo(w io.Writer) (int64, error) {
+	gridded, err := RenderPixels(g.img, g.config)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := encodeGridded(gridded, g.img, g.config.Normalize())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(data)
+	return int64(n), err
+}
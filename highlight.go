@@ -0,0 +1,123 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// HighlightCell composites fill over the given cell and draws the grid on top.
+// The highlight is inset from the cell edges by config.HighlightInset pixels and has
+// rounded corners when config.HighlightRounded is set, giving a softer selection that
+// does not run into the grid lines. Cells are numbered as drawn by AddGrid, and the result
+// is rotated like in AddGrid when Rotate is set. Returns the modified image as PNG bytes.
+func HighlightCell(img image.Image, cellNumber int, fill color.Color, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if fill == nil {
+		return nil, fmt.Errorf("fill color must not be nil")
+	}
+
+	overlay := newCanvas(img, config)
+	cell, err := cellRect(cellNumber, overlay.Bounds(), config.CellSize, config.Origin(), config.MergePartialCells)
+	if err != nil {
+		return nil, err
+	}
+
+	fillHighlight(overlay, cell, fill, config)
+
+	return encodeGridded(drawRotatedGrid(overlay, config, nil), img, config)
+}
+
+// cellRect returns the pixel bounds of a cell as numbered by AddGrid from origin, clipped to
+// bounds. With merge, columns and rows are counted as with MergePartialCells and a trailing
+// column or row too narrow to be numbered is part of the cells before it.
+func cellRect(cellNumber int, bounds image.Rectangle, cellSize int, origin NumberOrigin, merge bool) (image.Rectangle, error) {
+	columns, rows := gridDimensions(bounds.Max.X, bounds.Max.Y, cellSize)
+	if merge {
+		columns = columnsPerRow(bounds.Max.X, cellSize, MergeColumns)
+		rows = columnsPerRow(bounds.Max.Y, cellSize, MergeColumns)
+	}
+	if cellNumber < 0 {
+		return image.Rectangle{}, fmt.Errorf("%w: %d", ErrNegativeCell, cellNumber)
+	}
+	if cellNumber >= columns*rows {
+		return image.Rectangle{}, fmt.Errorf("%w: %d not in [0, %d)", ErrCellOutOfRange, cellNumber, columns*rows)
+	}
+
+	col, row := cellPosition(cellNumber, columns, rows, origin)
+	cell := image.Rect(
+		col*cellSize,
+		row*cellSize,
+		(col+1)*cellSize,
+		(row+1)*cellSize,
+	)
+	if merge && col == columns-1 {
+		cell.Max.X = bounds.Max.X
+	}
+	if merge && row == rows-1 {
+		cell.Max.Y = bounds.Max.Y
+	}
+
+	return cell.Intersect(bounds), nil
+}
+
+// fillCellBackgrounds composites the color of every cell listed in CellBackgrounds over the
+// part of its bounds that overlay covers. Cells outside the grid laid out over gridBounds and
+// nil colors are ignored.
+func fillCellBackgrounds(overlay *image.RGBA, gridBounds image.Rectangle, config Config) {
+	for cellNumber, fill := range config.CellBackgrounds {
+		if fill == nil {
+			continue
+		}
+		cell, err := cellRect(cellNumber, gridBounds, config.CellSize, config.Origin(), config.MergePartialCells)
+		if err != nil {
+			continue
+		}
+
+		cell = cell.Intersect(overlay.Bounds())
+		for y := cell.Min.Y; y < cell.Max.Y; y++ {
+			for x := cell.Min.X; x < cell.Max.X; x++ {
+				blendPixel(overlay, x, y, fill)
+			}
+		}
+	}
+}
+
+// fillHighlight composites fill over cell, applying the configured inset and rounding.
+// Rounded highlights use a corner radius of a quarter of the shorter side.
+func fillHighlight(overlay *image.RGBA, cell image.Rectangle, fill color.Color, config Config) {
+	r := cell.Inset(config.HighlightInset)
+	if r.Empty() {
+		return
+	}
+
+	radius := 0
+	if config.HighlightRounded {
+		radius = min(r.Dx(), r.Dy()) / 4
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if radius > 0 && !insideRoundedRect(x, y, r, radius) {
+				continue
+			}
+			blendPixel(overlay, x, y, fill)
+		}
+	}
+}
+
+// insideRoundedRect reports whether (x, y) lies inside r with corners rounded to radius.
+func insideRoundedRect(x, y int, r image.Rectangle, radius int) bool {
+	// Distance from the nearest corner circle center, zero along the straight edges
+	dx := max(r.Min.X+radius-x, x-(r.Max.X-1-radius), 0)
+	dy := max(r.Min.Y+radius-y, y-(r.Max.Y-1-radius), 0)
+
+	return dx*dx+dy*dy <= radius*radius
+}
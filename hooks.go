@@ -0,0 +1,29 @@
+package imgrid
+
+import "time"
+
+// Hooks receives notifications while a grid is rendered, e.g. to log where time goes in slow
+// renders. Set Config.Hooks to enable them; a nil Hooks costs nothing.
+type Hooks struct {
+	// OnPhase is called after each rendering phase with the phase name and the time it took.
+	// The phases are "canvas" (copying the source), "lines", "numbers", "rotate" (only with
+	// Rotate set) and "encode", in this order except that upright numbers on a rotated grid
+	// are drawn after "rotate". It is called synchronously from the rendering goroutine.
+	OnPhase func(phase string, d time.Duration)
+}
+
+// start returns the start time of a phase, or the zero time when no OnPhase hook is set.
+func (h *Hooks) start() time.Time {
+	if h == nil || h.OnPhase == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// end reports the time elapsed since start as phase to the OnPhase hook, if one is set.
+func (h *Hooks) end(phase string, start time.Time) {
+	if h == nil || h.OnPhase == nil {
+		return
+	}
+	h.OnPhase(phase, time.Since(start))
+}
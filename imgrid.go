@@ -9,6 +9,11 @@ import (
 	"image/color"
 	"image/draw"
 	"image/png"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
 )
 
 // Config holds grid overlay configuration.
@@ -19,213 +24,1707 @@ type Config struct {
 	NumberBG    color.Color // Background color for cell numbers (default: semi-transparent black)
 	LineWidth   int         // Width of grid lines in pixels (default: 2)
 	NumberScale int         // Scale factor for number size (default: 3)
+
+	NumberShadow      bool        // Draw a drop shadow behind number digits (default: false)
+	NumberShadowColor color.Color // Color of the number drop shadow (default: semi-transparent black)
+
+	PNGCompression png.CompressionLevel                     // Compression level of the PNG output (default: png.DefaultCompression)
+	Encoder        func(w io.Writer, img image.Image) error `json:"-"` // Custom output encoder used instead of PNG (default: nil, PNG)
+
+	Seamless      bool // Draw lines so the output tiles seamlessly when repeated (default: false)
+	CloseGrid     bool // Draw closing lines along the right and bottom image edges (default: false)
+	CenteredLines bool // Center lines on cell boundaries instead of extending them left/up (default: false)
+
+	CornerNumbers  bool        // Place numbers in the top-left cell corner instead of the center (default: false)
+	CornerDotColor color.Color // Color of the dot marking each cell origin in corner mode (default: white)
+
+	AutoContrastNumbers bool // Pick black or white numbers per cell to contrast with the content below (default: false)
+
+	CanvasPad   int         // Extend the canvas by this many pixels on every side for bleed (default: 0)
+	CanvasColor color.Color // Backdrop of the canvas: fills the pad area and shows through transparent source pixels (default: nil, transparent)
+
+	ValuePerCell float64 // Label each cell with its number times this value instead of the number (default: 0, disabled)
+	ValueFormat  string  // fmt verb used to format cell values (default: "", shortest decimal form)
+
+	HighlightInset   int  // Inset of cell highlights from the cell edges in pixels (default: 0)
+	HighlightRounded bool // Round the corners of cell highlights (default: false)
+
+	LabelEvery  int  // Only label cells whose number is a multiple of this; lines are unaffected (default: 1)
+	HideNumbers bool // Draw only the grid lines without cell numbers (default: false)
+	ResetPerRow bool // Restart label numbering at 0 on every row (default: false)
+
+	Rotate        int  // Rotate the output clockwise by 0, 90, 180 or 270 degrees (default: 0)
+	RotateNumbers bool // Rotate the numbers with the output instead of keeping them upright (default: false)
+
+	NumberWeight int // Thicken number strokes by this many pixels on each side (default: 0)
+
+	DrawDiagonals bool // Also draw the two corner-to-corner diagonals in GridColor (default: false)
+
+	NumberOrigin NumberOrigin // Corner holding cell 0; numbers increase away from it row by row (default: TopLeft)
+
+	CenterMarker MarkerStyle // Marker drawn at every cell center, below its number (default: MarkerNone)
+	MarkerColor  color.Color // Color of center markers (default: white)
+	MarkerSize   int         // Diameter of center markers in pixels (default: 10)
+
+	EmbedConfig bool // Store the configuration as JSON in a PNG tEXt chunk; see ReadConfig (default: false)
+
+	ExcludeCells map[int]bool // Cells left unlabeled, e.g. walls on a floor plan; numbering is unaffected (default: nil)
+
+	RulerMode bool // Draw ticks and pixel positions along the top and left edges instead of a full grid (default: false)
+
+	SkipShortRows float64 // Leave a partial last row unlabeled when shorter than this fraction of CellSize (default: 0, off)
+	DropShortRows bool    // Also omit the line above such a row, merging it into the row above (default: false)
+
+	EdgeFade         bool // Fade numbers and their backgrounds out toward the image edges (default: false)
+	EdgeFadeDistance int  // Distance from the edges in pixels over which numbers fade in (default: 0, a quarter of the shorter side)
+
+	MirrorX bool // Mirror the numbering horizontally, e.g. for right-to-left layouts (default: false)
+	MirrorY bool // Mirror the numbering vertically (default: false)
+
+	NumberPrefix string // Text drawn before every cell number, e.g. "#" (default: "")
+	NumberSuffix string // Text drawn after every cell number, e.g. ")" (default: "")
+
+	MergePartialCells bool // Merge a trailing column or row narrower than half CellSize into the one before it; its lines stay (default: false)
+
+	Hooks *Hooks `json:"-"` // Callbacks reporting the time spent in each rendering phase (default: nil)
+
+	NumberPixelHeight int // Approximate glyph height in pixels; overrides NumberScale when set (default: 0, use NumberScale)
+
+	KeepSource bool // Store the source image in PNG output that grids it, so RemoveGrid can restore it (default: false)
+
+	SubDivisions     int         // Split every cell into this many parts with lighter minor lines on both axes (default: 0, off)
+	SubDivisionColor color.Color // Color of the minor lines (default: nil, GridColor at 40% opacity)
+
+	AxisLabelRotation int // Turn the left ruler labels counterclockwise by 0, 90 (reading bottom to top) or 270 degrees (default: 0)
+
+	NumberStyle NumberStyle // Draw numbers centered, or small in the top-right or bottom-right cell corner (default: NumberNormal)
+
+	// CellOpacity returns a 0..1 multiplier for the opacity of the lines, number and marker
+	// drawn within a cell, e.g. to emphasize a region; col and row are as passed to CellLabel.
+	CellOpacity func(cell, col, row int) float64 `json:"-"` // Per-cell opacity of the grid (default: nil, fully opaque)
+
+	DrawAxes   bool        // Draw arrowed X and Y axes through AxesOrigin over the grid, like a Cartesian diagram (default: false)
+	AxesOrigin image.Point // Pixel where the axes cross, e.g. a cell corner from CellBounds (default: (0, 0))
+	AxesColor  color.Color // Color of the axes and arrowheads (default: nil, GridColor at full opacity)
+
+	// LinePattern fills the grid lines with a small tileable image, e.g. hatching, instead of
+	// GridColor. The pattern repeats from the top-left corner of the grid: its top-left pixel
+	// lands on every pixel whose coordinates are multiples of the pattern's width and height.
+	LinePattern image.Image `json:"-"` // Pattern sampled by the grid line pixels (default: nil, use GridColor)
+
+	WrapLabelAt int // Split labels longer than this many characters into two stacked lines (default: 0, off)
+
+	// SkipOverlappingLabels leaves out every label whose box, as measured by MeasureLabel, would
+	// overlap a label drawn before it, to declutter fine grids. Labels are drawn row by row from
+	// the top-left corner of the image, so which labels are skipped depends on that order.
+	SkipOverlappingLabels bool // Skip labels that would overlap an already drawn one (default: false)
+
+	CellBackgrounds map[int]color.Color // Colors composited over listed cells below the lines and numbers, e.g. for status charts (default: nil)
+
+	CellLabels map[int]string // Custom labels for listed cells, drawn instead of their numbers; other cells keep theirs (default: nil)
+}
+
+// NumberOrigin selects the corner of the grid that holds cell 0. Numbering proceeds row by row,
+// along each row away from the origin's side and then on to the next row away from its edge.
+// The values combine a horizontal bit (TopRight) and a vertical bit (BottomLeft).
+type NumberOrigin int
+
+const (
+	// TopLeft numbers left to right, top to bottom.
+	TopLeft NumberOrigin = iota
+	// TopRight numbers right to left, top to bottom.
+	TopRight
+	// BottomLeft numbers left to right, bottom to top.
+	BottomLeft
+	// BottomRight numbers right to left, bottom to top.
+	BottomRight
+)
+
+// NumberStyle selects the size and placement of cell numbers.
+type NumberStyle int
+
+const (
+	// NumberNormal draws numbers at full size in the cell center.
+	NumberNormal NumberStyle = iota
+	// NumberSuperscript draws numbers at half size in the top-right cell corner, like an index.
+	NumberSuperscript
+	// NumberSubscript draws numbers at half size in the bottom-right cell corner.
+	NumberSubscript
+)
+
+// Origin returns the corner holding cell 0 once MirrorX and MirrorY are applied to
+// NumberOrigin: MirrorX swaps left and right, MirrorY swaps top and bottom. Pass it to
+// CellToPixelOrigin and PixelToCellOrigin to convert coordinates on the drawn grid.
+func (c Config) Origin() NumberOrigin {
+	origin := c.NumberOrigin
+	if c.MirrorX {
+		origin ^= TopRight // Toggle the horizontal side
+	}
+	if c.MirrorY {
+		origin ^= BottomLeft // Toggle the vertical side
+	}
+
+	return origin
+}
+
+// cellPosition returns the grid column and row of a cell on a columns x rows grid numbered
+// from origin.
+func cellPosition(cellNumber, columns, rows int, origin NumberOrigin) (int, int) {
+	col, row := cellNumber%columns, cellNumber/columns
+	if origin == TopRight || origin == BottomRight {
+		col = columns - 1 - col
+	}
+	if origin == BottomLeft || origin == BottomRight {
+		row = rows - 1 - row
+	}
+
+	return col, row
+}
+
+// cellNumberAt returns the number of the cell at the given grid column and row of a
+// columns x rows grid numbered from origin. It is the inverse of cellPosition.
+func cellNumberAt(col, row, columns, rows int, origin NumberOrigin) int {
+	col, row = cellPosition(row*columns+col, columns, rows, origin)
+	return row*columns + col
+}
+
+// DefaultConfig returns a Config with sensible defaults.
+func DefaultConfig() Config {
+	return Config{
+		CellSize:    100,
+		GridColor:   color.RGBA{0, 255, 255, 100}, // Semi-transparent cyan
+		NumberColor: color.RGBA{255, 255, 255, 255}, // White
+		NumberBG:    color.RGBA{0, 0, 0, 200}, // Semi-transparent black
+		LineWidth:   2,
+		NumberScale: 3,
+
+		NumberShadowColor: color.RGBA{0, 0, 0, 160}, // Semi-transparent black
+
+		PNGCompression: png.DefaultCompression,
+
+		CornerDotColor: color.RGBA{255, 255, 255, 255}, // White
+
+		LabelEvery: 1,
+
+		MarkerColor: color.RGBA{255, 255, 255, 255}, // White
+		MarkerSize:  10,
+	}
+}
+
+// Normalize returns a copy of c with zero or nil fields that would otherwise break rendering
+// replaced by their DefaultConfig values: CellSize, LineWidth, NumberScale, LabelEvery and
+// MarkerSize when zero, and GridColor, NumberColor, NumberBG, NumberShadowColor, CornerDotColor
+// and MarkerColor when nil.
+// Flags and fields whose zero value is meaningful (e.g. CanvasPad, CanvasColor, Encoder) are
+// left unchanged. To hide lines or number backgrounds, set a fully transparent color.
+func (c Config) Normalize() Config {
+	defaults := DefaultConfig()
+	if c.CellSize == 0 {
+		c.CellSize = defaults.CellSize
+	}
+	if c.GridColor == nil {
+		c.GridColor = defaults.GridColor
+	}
+	if c.NumberColor == nil {
+		c.NumberColor = defaults.NumberColor
+	}
+	if c.NumberBG == nil {
+		c.NumberBG = defaults.NumberBG
+	}
+	if c.LineWidth == 0 {
+		c.LineWidth = defaults.LineWidth
+	}
+	if c.NumberScale == 0 {
+		c.NumberScale = defaults.NumberScale
+	}
+	if c.NumberShadowColor == nil {
+		c.NumberShadowColor = defaults.NumberShadowColor
+	}
+	if c.CornerDotColor == nil {
+		c.CornerDotColor = defaults.CornerDotColor
+	}
+	if c.LabelEvery == 0 {
+		c.LabelEvery = defaults.LabelEvery
+	}
+	if c.MarkerColor == nil {
+		c.MarkerColor = defaults.MarkerColor
+	}
+	if c.MarkerSize == 0 {
+		c.MarkerSize = defaults.MarkerSize
+	}
+
+	return c
+}
+
+// With returns a copy of c with every field that is set in overrides copied over, e.g. to
+// apply per-call tweaks to a shared theme. A field counts as set when it is not its zero value
+// (non-zero numbers, true flags, non-nil colors, maps and Encoder). Zero values in overrides are
+// ignored, so With cannot turn a flag off or reset a number to 0; assign such fields directly
+// on the result instead.
+func (c Config) With(overrides Config) Config {
+	dst := reflect.ValueOf(&c).Elem()
+	src := reflect.ValueOf(overrides)
+	for i := 0; i < src.NumField(); i++ {
+		if field := src.Field(i); !field.IsZero() {
+			dst.Field(i).Set(field)
+		}
+	}
+
+	return c
+}
+
+// AddGrid overlays a numbered grid on the provided image using the given configuration.
+// The configuration is normalized first, so fields left zero take their default values.
+// Any image.Image is accepted as the source; see copyImage for how it is converted.
+// Returns the modified image as PNG bytes.
+func AddGrid(img image.Image, config Config) ([]byte, error) {
+	gridded, err := RenderPixels(img, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeGridded(gridded, img, config.Normalize())
+}
+
+// RenderPixels renders the gridded image exactly like AddGrid but returns its pixels instead
+// of encoding them. Unlike encoded bytes, which may change with the PNG encoder of a Go
+// release, the pixels only change when the rendering itself does, so tests can compare them
+// against golden images, e.g. with imgridtest.CompareImages. The result starts at the origin.
+// Where a semi-transparent grid is drawn over transparent pixels, the buffer can hold values
+// that PNG encoding clamps, so those pixels differ from a decoded golden PNG.
+func RenderPixels(img image.Image, config Config) (*image.RGBA, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderGrid(img, config, nil), nil
+}
+
+// AddGridWithLabels overlays a grid like AddGrid, labeling cell i with labels[i] in row-major
+// order. An empty string leaves a cell unlabeled, and cells past the end of labels get their
+// default number. Labels can use digits, the letters A-Z (lowercase is drawn as uppercase),
+// numeric punctuation and the symbols '#', '(', ')', '[' and ']'. Returns the modified image
+// as PNG bytes.
+func AddGridWithLabels(img image.Image, labels []string, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeGridded(renderGrid(img, config, labels), img, config)
+}
+
+// AddGridLayered draws several grids onto the same image in one allocation, e.g. a coarse
+// numbered grid over a fine unnumbered one. Grids are drawn in the order of configs, so later
+// configurations end up on top. Each configuration is normalized like in AddGrid. The canvas
+// and PNG encoding settings (CanvasPad, CanvasColor, PNGCompression) are taken from the first
+// configuration.
+// Returns the modified image as PNG bytes.
+func AddGridLayered(img image.Image, configs []Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no grid configurations given")
+	}
+	normalized := make([]Config, len(configs))
+	for i, config := range configs {
+		config, err := normalizeConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("config %d: %w", i, err)
+		}
+		normalized[i] = config
+	}
+
+	overlay := newCanvas(img, normalized[0])
+	for _, config := range normalized {
+		drawGrid(overlay, config)
+	}
+
+	return encodeGridded(overlay, img, normalized[0])
+}
+
+// AddGridReuse copies src into dst and draws the grid onto it, leaving the result in dst
+// for the caller to encode. dst must have the same bounds as src, or the padded canvas bounds
+// when CanvasPad is set. Reusing dst across calls avoids allocating a new output image for
+// every frame in hot loops. The grid is drawn in place, so a nonzero Rotate is an error.
+func AddGridReuse(dst *image.RGBA, src image.Image, config Config) error {
+	if err := checkImageSize(src); err != nil {
+		return err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return err
+	}
+	if config.Rotate != 0 {
+		return fmt.Errorf("rotation cannot be applied in place: %d", config.Rotate)
+	}
+	if want := canvasBounds(src.Bounds(), config); dst.Bounds() != want {
+		return fmt.Errorf("destination bounds %v do not match canvas bounds %v", dst.Bounds(), want)
+	}
+
+	pasteSource(dst, src, config)
+	drawGrid(dst, config)
+
+	return nil
+}
+
+// AddGrids renders one gridded variant of img per configuration, e.g. fine, medium and coarse
+// grids of the same upload. The source is converted to RGBA once and that copy is reused for
+// every variant. Returns the PNG bytes of each variant in the order of configs; errors name
+// the index of the configuration that failed.
+func AddGrids(img image.Image, configs []Config) ([][]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	base := copyImage(img)
+	results := make([][]byte, len(configs))
+
+	var work *image.RGBA
+	for i, config := range configs {
+		config, err := normalizeConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("config %d: %w", i, err)
+		}
+
+		bounds := canvasBounds(base.Bounds(), config)
+		if work == nil || work.Bounds() != bounds {
+			work = image.NewRGBA(bounds)
+		}
+		pasteSource(work, base, config)
+
+		data, err := encodeGridded(drawRotatedGrid(work, config, nil), img, config)
+		if err != nil {
+			return nil, fmt.Errorf("config %d: %w", i, err)
+		}
+		results[i] = data
+	}
+
+	return results, nil
+}
+
+// SpotlightCell dims everything outside the given cell by compositing dim over it,
+// leaving the chosen cell at full brightness. The grid is drawn on top of the result.
+// Cells are numbered as drawn by AddGrid, including partial cells at the right and bottom edges,
+// and the result is rotated like in AddGrid when Rotate is set.
+// Returns the modified image as PNG bytes.
+func SpotlightCell(img image.Image, cellNumber int, dim color.Color, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if dim == nil {
+		return nil, fmt.Errorf("dim color must not be nil")
+	}
+
+	overlay := newCanvas(img, config)
+	bounds := overlay.Bounds()
+	cell, err := cellRect(cellNumber, bounds, config.CellSize, config.Origin(), config.MergePartialCells)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dim the four bands surrounding the cell
+	src := &image.Uniform{dim}
+	for _, r := range []image.Rectangle{
+		image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, cell.Min.Y),
+		image.Rect(bounds.Min.X, cell.Max.Y, bounds.Max.X, bounds.Max.Y),
+		image.Rect(bounds.Min.X, cell.Min.Y, cell.Min.X, cell.Max.Y),
+		image.Rect(cell.Max.X, cell.Min.Y, bounds.Max.X, cell.Max.Y),
+	} {
+		draw.Draw(overlay, r.Intersect(bounds), src, image.Point{}, draw.Over)
+	}
+
+	return encodeGridded(drawRotatedGrid(overlay, config, nil), img, config)
+}
+
+// GridMask renders only the grid geometry for an image of the given size and returns it as
+// an 8-bit grayscale PNG. Pixels of grid lines, minor lines, number glyphs, markers, corner
+// dots and axes are white (255), everything else is black (0); anti-aliased edges count as
+// white where they cover at least half a pixel. Colors in config are ignored, as are
+// CellOpacity, EdgeFade and AutoContrastNumbers; number backgrounds are not part of the mask.
+func GridMask(width, height int, config Config) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid mask size: %dx%d", width, height)
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GridColor = color.White
+	config.SubDivisionColor = color.White
+	config.AxesColor = color.White
+	config.MarkerColor = color.White
+	config.CornerDotColor = color.White
+	config.LinePattern = nil
+	config.CellBackgrounds = nil
+	config.NumberColor = color.White
+	config.NumberBG = color.Transparent
+	config.NumberShadow = false
+	config.AutoContrastNumbers = false
+	config.EdgeFade = false
+	config.CellOpacity = nil
+	config.Encoder = nil
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	drawGrid(canvas, config)
+
+	// Anti-aliased marker edges are gray; count pixels covered at least halfway as geometry
+	mask := image.NewGray(canvas.Bounds())
+	for i := range mask.Pix {
+		if canvas.Pix[4*i] >= 128 {
+			mask.Pix[i] = 255
+		}
+	}
+
+	return encodeImage(mask, config)
+}
+
+// NewGridImage renders a standalone width x height grid with no source image, e.g. for
+// graph-paper style images. The canvas is filled with CanvasColor, or white when that is nil,
+// and the grid is drawn over it like AddGrid, honoring CanvasPad and Rotate. Returns the image
+// as PNG bytes.
+func NewGridImage(width, height int, config Config) ([]byte, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	background := config.CanvasColor
+	if background == nil {
+		background = color.White
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+
+	return encodeImage(renderGrid(canvas, config, nil), config)
+}
+
+// renderGrid draws the grid, with optional label overrides as in drawGridWithLabels, on a
+// canvas built from img and applies the configured rotation.
+func renderGrid(img image.Image, config Config, labels []string) *image.RGBA {
+	start := config.Hooks.start()
+	canvas := newCanvas(img, config)
+	config.Hooks.end("canvas", start)
+
+	return drawRotatedGrid(canvas, config, labels)
+}
+
+// drawRotatedGrid draws the grid onto canvas and applies the configured rotation. Without
+// rotation the grid is drawn in place and canvas itself is returned.
+func drawRotatedGrid(canvas *image.RGBA, config Config, labels []string) *image.RGBA {
+	bounds := canvas.Bounds()
+	start := config.Hooks.start()
+	drawGridLines(canvas, bounds, config)
+	config.Hooks.end("lines", start)
+
+	if config.Rotate == 0 || config.RotateNumbers {
+		start = config.Hooks.start()
+		drawGridNumbers(canvas, bounds, config, labels, nil)
+		config.Hooks.end("numbers", start)
+
+		return rotate(canvas, config)
+	}
+
+	// Rotate the lines with the image, then draw the numbers upright at the
+	// rotated positions of their cells
+	rotated := rotate(canvas, config)
+	start = config.Hooks.start()
+	drawGridNumbers(rotated, bounds, config, labels, func(x, y int) (int, int) {
+		return rotatePoint(x, y, bounds, config.Rotate)
+	})
+	config.Hooks.end("numbers", start)
+
+	return rotated
+}
+
+// rotate applies the configured rotation to canvas, reporting it as the "rotate" phase when
+// there is any.
+func rotate(canvas *image.RGBA, config Config) *image.RGBA {
+	if config.Rotate == 0 {
+		return canvas
+	}
+
+	start := config.Hooks.start()
+	defer config.Hooks.end("rotate", start)
+
+	return rotateImage(canvas, config.Rotate)
+}
+
+// rotateImage returns img rotated clockwise by degrees (0, 90, 180 or 270). The result
+// starts at the origin; for 90 and 270 degrees its width and height are swapped.
+func rotateImage(img *image.RGBA, degrees int) *image.RGBA {
+	if degrees == 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	size := bounds.Size()
+	if degrees == 90 || degrees == 270 {
+		size.X, size.Y = size.Y, size.X
+	}
+
+	rotated := image.NewRGBA(image.Rectangle{Max: size})
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			rx, ry := rotatePoint(x, y, bounds, degrees)
+			i := img.PixOffset(x, y)
+			j := rotated.PixOffset(rx, ry)
+			copy(rotated.Pix[j:j+4], img.Pix[i:i+4])
+		}
+	}
+
+	return rotated
+}
+
+// rotatePoint maps a pixel of an image with the given bounds to its position after
+// rotating the image clockwise by degrees, as done by rotateImage.
+func rotatePoint(x, y int, bounds image.Rectangle, degrees int) (int, int) {
+	x -= bounds.Min.X
+	y -= bounds.Min.Y
+	width, height := bounds.Dx(), bounds.Dy()
+
+	switch degrees {
+	case 90:
+		return height - 1 - y, x
+	case 180:
+		return width - 1 - x, height - 1 - y
+	case 270:
+		return y, width - 1 - x
+	}
+	return x, y
+}
+
+// checkImageSize returns an error if img has no pixels, which cannot be gridded or encoded.
+func checkImageSize(img image.Image) error {
+	if size := img.Bounds().Size(); size.X <= 0 || size.Y <= 0 {
+		return fmt.Errorf("invalid image size: %dx%d", size.X, size.Y)
+	}
+
+	return nil
+}
+
+// normalizeConfig normalizes config and checks the result with validateConfig, as every
+// function that renders a grid does first.
+func normalizeConfig(config Config) (Config, error) {
+	config = config.Normalize()
+	if err := validateConfig(config); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// validateConfig checks the configuration for values that cannot be rendered.
+func validateConfig(config Config) error {
+	if config.CellSize <= 0 {
+		return fmt.Errorf("invalid cell size: %d", config.CellSize)
+	}
+	switch config.PNGCompression {
+	case png.DefaultCompression, png.NoCompression, png.BestSpeed, png.BestCompression:
+	default:
+		return fmt.Errorf("invalid PNG compression level: %d", config.PNGCompression)
+	}
+	if config.CanvasPad < 0 {
+		return fmt.Errorf("invalid canvas pad: %d", config.CanvasPad)
+	}
+	switch config.Rotate {
+	case 0, 90, 180, 270:
+	default:
+		return fmt.Errorf("invalid rotation: %d (must be 0, 90, 180 or 270)", config.Rotate)
+	}
+	switch config.AxisLabelRotation {
+	case 0, 90, 270:
+	default:
+		return fmt.Errorf("invalid axis label rotation: %d (must be 0, 90 or 270)", config.AxisLabelRotation)
+	}
+	return nil
+}
+
+// copyImage returns an RGBA copy of img to draw on. All compositing happens afterwards on
+// this alpha-premultiplied copy, so an *image.NRGBA source and an *image.RGBA source holding
+// the same colors produce identical output, including under semi-transparent grid colors.
+// image/draw has dedicated conversion paths for *image.RGBA, *image.NRGBA, *image.Gray,
+// *image.YCbCr and *image.CMYK (the types image/jpeg decodes to, with Adobe CMYK inversion
+// already undone), so those sources keep their exact colors. Other types go through their
+// color model's RGBA conversion.
+func copyImage(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	overlay := image.NewRGBA(bounds)
+	draw.Draw(overlay, bounds, img, bounds.Min, draw.Src)
+	return overlay
+}
+
+// newCanvas returns the RGBA image the grid is drawn on: a copy of img, enlarged by
+// CanvasPad on every side when a pad is configured and flattened onto CanvasColor when one
+// is set.
+func newCanvas(img image.Image, config Config) *image.RGBA {
+	if config.CanvasPad == 0 && config.CanvasColor == nil {
+		return copyImage(img)
+	}
+
+	canvas := image.NewRGBA(canvasBounds(img.Bounds(), config))
+	pasteSource(canvas, img, config)
+	return canvas
+}
+
+// canvasBounds returns the bounds of the canvas for a source with the given bounds.
+// A padded canvas starts at the origin and is the size of the source plus CanvasPad on
+// every side, wherever the source bounds start.
+func canvasBounds(src image.Rectangle, config Config) image.Rectangle {
+	if config.CanvasPad == 0 {
+		return src
+	}
+
+	pad := config.CanvasPad
+	return image.Rect(0, 0, src.Dx()+2*pad, src.Dy()+2*pad)
+}
+
+// pasteSource fills canvas with CanvasColor and draws img onto it, offset by CanvasPad. With
+// a CanvasColor, img is composited over that color instead of copied, so its transparent
+// regions take on the backdrop.
+func pasteSource(canvas *image.RGBA, img image.Image, config Config) {
+	r := img.Bounds()
+	if pad := config.CanvasPad; pad > 0 || config.CanvasColor != nil {
+		fill := image.Image(image.Transparent)
+		if config.CanvasColor != nil {
+			fill = &image.Uniform{config.CanvasColor}
+		}
+		draw.Draw(canvas, canvas.Bounds(), fill, image.Point{}, draw.Src)
+		if pad > 0 {
+			// The padded canvas starts at the origin, so move the source's top-left corner
+			// to (pad, pad)
+			r = r.Add(image.Pt(pad, pad).Sub(r.Min))
+		}
+	}
+
+	if config.CanvasColor != nil {
+		draw.Draw(canvas, r, img, img.Bounds().Min, draw.Over)
+		return
+	}
+
+	draw.Draw(canvas, r, img, img.Bounds().Min, draw.Src)
+}
+
+// gridDimensions returns the number of columns and rows drawn by AddGrid,
+// counting partial cells at the right and bottom edges.
+func gridDimensions(width, height, cellSize int) (int, int) {
+	return (width + cellSize - 1) / cellSize, (height + cellSize - 1) / cellSize
+}
+
+// numberedDimensions returns the number of columns and rows that get cell numbers. It matches
+// gridDimensions unless MergePartialCells drops a trailing column or row narrower than half
+// CellSize, which is then numbered as part of the cells before it.
+func numberedDimensions(width, height int, config Config) (int, int) {
+	columns, rows := gridDimensions(width, height, config.CellSize)
+	if config.MergePartialCells {
+		columns = columnsPerRow(width, config.CellSize, MergeColumns)
+		rows = columnsPerRow(height, config.CellSize, MergeColumns)
+	}
+
+	return columns, rows
+}
+
+// drawGrid draws the grid lines and cell numbers onto overlay.
+func drawGrid(overlay *image.RGBA, config Config) {
+	drawGridWithLabels(overlay, config, nil)
+}
+
+// drawGridWithLabels draws the grid lines and cell labels onto overlay. labels[i] replaces
+// the label of cell i; an empty string leaves the cell unlabeled and cells past the end of
+// labels get their default label.
+func drawGridWithLabels(overlay *image.RGBA, config Config, labels []string) {
+	drawGridLines(overlay, overlay.Bounds(), config)
+	drawGridNumbers(overlay, overlay.Bounds(), config, labels, nil)
+}
+
+// drawGridLines draws the lines of a grid laid out over gridBounds onto overlay, above the
+// CellBackgrounds. overlay may cover only part of the grid, in which case only the visible part
+// of the lines is drawn.
+func drawGridLines(overlay *image.RGBA, gridBounds image.Rectangle, config Config) {
+	width, height := gridBounds.Max.X, gridBounds.Max.Y
+	fillCellBackgrounds(overlay, gridBounds, config)
+
+	// Seamless grids also get a line on the leading edge. Its width wraps around
+	// to the trailing edge so that tiled copies of the output line up.
+	firstLine := config.CellSize
+	if config.Seamless {
+		firstLine = 0
+	}
+
+	// The axes go on top of the grid lines
+	if config.DrawAxes {
+		defer drawAxes(overlay, width, height, config)
+	}
+
+	bounds := overlay.Bounds()
+	var rects []image.Rectangle
+	if config.RulerMode {
+		rects = tickRects(width, height, bounds, config)
+	} else {
+		xs := linePositions(firstLine, width, bounds.Min.X, bounds.Max.X, config)
+		ys := linePositions(firstLine, height, bounds.Min.Y, bounds.Max.Y, config)
+		if config.DropShortRows && isShortLastRow(height, config) {
+			// Merge the sliver into the row above by leaving out the line between them
+			_, rows := gridDimensions(width, height, config.CellSize)
+			if n := len(ys); n > 0 && ys[n-1] == (rows-1)*config.CellSize {
+				ys = ys[:n-1]
+			}
+		}
+		rects = lineRects(xs, ys, width, height, bounds, config)
+		if config.SubDivisions > 1 {
+			drawSubDivisions(overlay, width, height, rects, config)
+		}
+	}
+
+	// An opaque color looks the same however often a pixel is painted, so straight
+	// lines can be filled directly without building and scanning a mask
+	if isOpaque(config.GridColor) && !config.DrawDiagonals && config.CellOpacity == nil && config.LinePattern == nil {
+		src := &image.Uniform{config.GridColor}
+		for _, r := range rects {
+			draw.Draw(overlay, r, src, image.Point{}, draw.Src)
+		}
+		return
+	}
+
+	// Collect all line pixels in a mask first and composite the grid color once,
+	// so pixels where lines cross are not drawn twice and lines have uniform opacity.
+	// Every line feature must mark this mask rather than drawing on overlay directly.
+	lines := image.NewAlpha(bounds)
+	for _, r := range rects {
+		draw.Draw(lines, r, image.Opaque, image.Point{}, draw.Src)
+	}
+	if config.DrawDiagonals {
+		markSegment(lines, 0, 0, width-1, height-1, config)
+		markSegment(lines, width-1, 0, 0, height-1, config)
+	}
+	if config.CellOpacity != nil {
+		fadeCells(lines, width, height, config)
+	}
+	compositeLines(overlay, lines, config)
+}
+
+// drawGridNumbers draws the cell labels and center markers of a grid laid out over gridBounds onto dst.
+// labels[i] replaces the label of cell i as in drawGridWithLabels. If transform is not nil,
+// it maps positions in grid coordinates to dst coordinates, e.g. when dst has been rotated;
+// labels themselves are always drawn upright.
+func drawGridNumbers(dst *image.RGBA, gridBounds image.Rectangle, config Config, labels []string, transform func(x, y int) (int, int)) {
+	width, height := gridBounds.Max.X, gridBounds.Max.Y
+	place := func(x, y int) (int, int) {
+		if transform == nil {
+			return x, y
+		}
+		return transform(x, y)
+	}
+
+	config = scaledLabel(config)
+	if config.RulerMode {
+		drawRulerLabels(dst, width, height, config, place)
+		return
+	}
+
+	// Superscript and subscript numbers are drawn at half the scale, rounded up
+	if config.NumberStyle != NumberNormal {
+		config.NumberScale = max((config.NumberScale+1)/2, 1)
+		config.NumberPixelHeight = 0
+	}
+
+	// Add sequential numbers in center of each cell, counting from NumberOrigin. Merged
+	// partial cells lie past the last column or row and are skipped below.
+	columns, rows := numberedDimensions(width, height, config)
+
+	// Rows cut short by the bottom edge may be left unlabeled
+	shortRow := -1
+	if isShortLastRow(height, config) {
+		shortRow = rows - 1
+	}
+
+	// When dst covers only part of the grid, skip cells whose label and marker cannot reach it.
+	// Skipping overlapping labels depends on every label drawn before, so it needs all cells.
+	firstCol, endCol, firstRow, endRow := 0, columns, 0, rows
+	if transform == nil && !config.SkipOverlappingLabels {
+		area := dst.Bounds().Inset(-numberReach(config, columns, rows, labels))
+		firstCol = max(area.Min.X/config.CellSize, 0)
+		endCol = min((area.Max.X+config.CellSize-1)/config.CellSize, columns)
+		firstRow = max(area.Min.Y/config.CellSize, 0)
+		endRow = min((area.Max.Y+config.CellSize-1)/config.CellSize, rows)
+	}
+
+	var drawn *labelBoxes
+	if config.SkipOverlappingLabels {
+		drawn = newLabelBoxes(config.CellSize)
+	}
+
+	for gridY := firstRow; gridY < endRow; gridY++ {
+		for gridX := firstCol; gridX < endCol; gridX++ {
+			cellNumber := cellNumberAt(gridX, gridY, columns, rows, config.Origin())
+			label := CellLabel(cellNumber, cellNumber%columns, cellNumber/columns, config)
+			if cellNumber < len(labels) {
+				label = labels[cellNumber]
+			}
+
+			// Calculate center of the cell
+			centerX := gridX*config.CellSize + config.CellSize/2
+			centerY := gridY*config.CellSize + config.CellSize/2
+
+			// A cell larger than the image covers it entirely, so center its label on the image
+			if config.CellSize > width {
+				centerX = width / 2
+			}
+			if config.CellSize > height {
+				centerY = height / 2
+			}
+
+			if gridY == shortRow {
+				continue
+			}
+
+			cellConfig := fadeCell(config, cellOpacity(gridX, gridY, columns, rows, config))
+			if centerX < width && centerY < height {
+				markerX, markerY := place(centerX, centerY)
+				drawMarker(dst, markerX, markerY, cellConfig)
+			}
+
+			// EdgeFade goes by the cell center, also for labels tucked into a corner
+			labelConfig := cellConfig
+			if config.EdgeFade {
+				labelConfig = fadeLabel(cellConfig, edgeFade(centerX, centerY, width, height, config))
+			}
+
+			// Corner mode marks the cell origin with a dot and tucks the label into
+			// the top-left corner, inset to stay clear of the grid lines and the dot
+			if config.CornerNumbers {
+				originX := gridX * config.CellSize
+				originY := gridY * config.CellSize
+				dotX, dotY := place(originX, originY)
+				fillCircle(dst, dotX, dotY, config.NumberScale, cellConfig.CornerDotColor)
+
+				labelWidth, labelHeight := MeasureLabel(label, config)
+				inset := config.LineWidth + config.NumberScale
+				centerX = originX + inset + labelWidth/2
+				centerY = originY + inset + labelHeight/2
+			} else if config.NumberStyle != NumberNormal {
+				// Superscript and subscript numbers are tucked into the right corners,
+				// inset like corner labels from the visible part of the cell
+				labelWidth, labelHeight := MeasureLabel(label, config)
+				inset := config.LineWidth + config.NumberScale
+				right := min((gridX+1)*config.CellSize, width)
+				centerX = right - inset - (labelWidth+1)/2
+				centerY = gridY*config.CellSize + inset + labelHeight/2
+				if config.NumberStyle == NumberSubscript {
+					bottom := min((gridY+1)*config.CellSize, height)
+					centerY = bottom - inset - (labelHeight+1)/2
+				}
+			}
+
+			// Only draw if center is within bounds
+			if centerX < width && centerY < height && !config.HideNumbers && shouldLabel(cellNumber, config) {
+				labelX, labelY := place(centerX, centerY)
+				if drawn != nil && label != "" && !drawn.add(labelBox(labelX, labelY, label, labelConfig)) {
+					continue
+				}
+				DrawLabel(dst, labelX, labelY, label, labelConfig)
+			}
+		}
+	}
+}
+
+// linePositions returns the positions of the grid lines from firstLine up to length, one
+// every CellSize pixels, that can touch pixels in [lo, hi). Skipping the rest keeps drawing
+// a small part of a huge grid cheap. The leading line of a seamless grid is always included
+// because its width wraps around to the trailing edge.
+func linePositions(firstLine, length, lo, hi int, config Config) []int {
+	start := firstLine
+	if skip := lo - config.LineWidth - firstLine; skip > 0 {
+		start += skip / config.CellSize * config.CellSize
+	}
+
+	var positions []int
+	if config.Seamless && start > 0 {
+		positions = append(positions, 0)
+	}
+	for p := start; p < length && p < hi+config.LineWidth; p += config.CellSize {
+		positions = append(positions, p)
+	}
+
+	return positions
+}
+
+// edgeFade returns the opacity factor in [0, 1] EdgeFade applies to the label of the cell
+// centered at (x, y): it grows linearly with the distance to the nearest image edge and
+// reaches 1 at EdgeFadeDistance, or at a quarter of the shorter image side when that is 0.
+func edgeFade(x, y, width, height int, config Config) float64 {
+	distance := config.EdgeFadeDistance
+	if distance <= 0 {
+		distance = min(width, height) / 4
+	}
+	if distance <= 0 {
+		return 1
+	}
+
+	d := min(x, y, width-x, height-y)
+	return math.Max(0, math.Min(1, float64(d)/float64(distance)))
+}
+
+// fadeLabel returns config with the opacity of its label colors scaled by factor.
+func fadeLabel(config Config, factor float64) Config {
+	for _, c := range []*color.Color{&config.NumberColor, &config.NumberBG, &config.NumberShadowColor} {
+		if *c != nil {
+			*c = withCoverage(*c, factor)
+		}
+	}
+	return config
+}
+
+// scaledLabel returns config with NumberScale derived from NumberPixelHeight when that is set:
+// glyphs are 7 blocks tall, so the scale is the requested height divided by 7, rounded to the
+// nearest whole block and at least 1.
+func scaledLabel(config Config) Config {
+	if config.NumberPixelHeight > 0 {
+		config.NumberScale = max(1, (config.NumberPixelHeight+3)/7)
+	}
+	return config
+}
+
+// isShortLastRow reports whether the partial last row of a grid of the given height is
+// shorter than SkipShortRows times CellSize, so it gets no labels.
+func isShortLastRow(height int, config Config) bool {
+	if config.SkipShortRows <= 0 || height%config.CellSize == 0 {
+		return false
+	}
+	return float64(height%config.CellSize) < config.SkipShortRows*float64(config.CellSize)
+}
+
+// numberReach returns how far, in pixels, the label and marker drawn for a cell can extend
+// beyond the cell's bounds. Labels are measured for the first and last cell, whose numbers
+// are the longest by default, and for every label override and custom cell label.
+func numberReach(config Config, columns, rows int, labels []string) int {
+	first := CellLabel(0, 0, 0, config)
+	last := CellLabel(columns*rows-1, columns-1, rows-1, config)
+
+	widest := 0
+	for _, label := range append([]string{first, last}, labels...) {
+		width, height := MeasureLabel(label, config)
+		widest = max(widest, width, height)
+	}
+	for _, label := range config.CellLabels {
+		width, height := MeasureLabel(label, config)
+		widest = max(widest, width, height)
+	}
+
+	shadow := 0
+	if config.NumberShadow {
+		shadow = (config.NumberScale + 1) / 2
+	}
+
+	// Generous on purpose: a centered label stays within half its size of the cell center,
+	// and a corner label within its inset plus its size of the cell origin
+	return config.CellSize + widest + max(config.NumberWeight, 0) + shadow + config.MarkerSize + config.LineWidth + config.NumberScale
+}
+
+// markLines marks the pixels of vertical lines at xs and horizontal lines at ys in the mask.
+// By default each line extends LineWidth pixels from its position toward decreasing
+// coordinates; with CenteredLines the width is split evenly around the position. The grid
+// spans width x height pixels from the origin; only the part inside the mask is marked.
+func markLines(lines *image.Alpha, xs, ys []int, width, height int, config Config) {
+	for _, r := range lineRects(xs, ys, width, height, lines.Bounds(), config) {
+		draw.Draw(lines, r, image.Opaque, image.Point{}, draw.Src)
+	}
+}
+
+// lineRects returns the pixel rectangles covered by vertical lines at xs and horizontal lines
+// at ys, including the closing lines of CloseGrid, clipped to clip. Rectangles may overlap
+// where lines cross. See markLines for how lines are placed.
+func lineRects(xs, ys []int, width, height int, clip image.Rectangle, config Config) []image.Rectangle {
+	visible := image.Rect(0, 0, width, height).Intersect(clip)
+	lead := lineLead(config)
+
+	var rects []image.Rectangle
+	add := func(r image.Rectangle) {
+		if r = r.Intersect(visible); !r.Empty() {
+			rects = append(rects, r)
+		}
+	}
+
+	// Vertical lines
+	for _, x := range xs {
+		for i := 0; i < config.LineWidth; i++ {
+			px, ok := linePixel(x-lead+i, width, config.Seamless)
+			if ok {
+				add(image.Rect(px, visible.Min.Y, px+1, visible.Max.Y))
+			}
+		}
+	}
+
+	// Horizontal lines
+	for _, y := range ys {
+		for i := 0; i < config.LineWidth; i++ {
+			py, ok := linePixel(y-lead+i, height, config.Seamless)
+			if ok {
+				add(image.Rect(visible.Min.X, py, visible.Max.X, py+1))
+			}
+		}
+	}
+
+	// Closing lines along the right and bottom edges, which the interior lines never reach
+	if config.CloseGrid {
+		add(image.Rect(width-config.LineWidth, visible.Min.Y, width, visible.Max.Y))
+		add(image.Rect(visible.Min.X, height-config.LineWidth, visible.Max.X, height))
+	}
+
+	return rects
+}
+
+// markSegment marks the pixels of a straight line from (x0, y0) to (x1, y1), both inclusive,
+// in the mask using Bresenham's algorithm. Lines are LineWidth pixels thick, measured across
+// the line's major axis and placed like grid lines (see lineLead). Pixels outside the mask are
+// skipped.
+func markSegment(lines *image.Alpha, x0, y0, x1, y1 int, config Config) {
+	dx, dy := x1-x0, y1-y0
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	stepX, stepY := 1, 1
+	if x1 < x0 {
+		stepX = -1
+	}
+	if y1 < y0 {
+		stepY = -1
+	}
+
+	// Thicken mostly horizontal lines vertically and mostly vertical lines horizontally
+	lead := lineLead(config)
+	mark := func(x, y int) {
+		for i := 0; i < config.LineWidth; i++ {
+			if dx >= dy {
+				lines.SetAlpha(x, y-lead+i, color.Alpha{255})
+			} else {
+				lines.SetAlpha(x-lead+i, y, color.Alpha{255})
+			}
+		}
+	}
+
+	x, y := x0, y0
+	err := dx - dy
+	for {
+		mark(x, y)
+		if x == x1 && y == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 > -dy {
+			err -= dy
+			x += stepX
+		}
+		if e2 < dx {
+			err += dx
+			y += stepY
+		}
+	}
+}
+
+// lineLead returns the offset of a line's first pixel before its position.
+func lineLead(config Config) int {
+	if config.CenteredLines {
+		return config.LineWidth / 2
+	}
+	return config.LineWidth - 1
+}
+
+// linePixel maps a line pixel coordinate into [0, length). Seamless grids wrap pixels
+// around to the opposite edge; otherwise pixels outside the image are dropped.
+func linePixel(p, length int, seamless bool) (int, bool) {
+	if p >= 0 && p < length {
+		return p, true
+	}
+	if !seamless || length == 0 {
+		return 0, false
+	}
+
+	return ((p % length) + length) % length, true
 }
 
-// DefaultConfig returns a Config with sensible defaults.
-func DefaultConfig() Config {
-	return Config{
-		CellSize:    100,
-		GridColor:   color.RGBA{0, 255, 255, 100}, // Semi-transparent cyan
-		NumberColor: color.RGBA{255, 255, 255, 255}, // White
-		NumberBG:    color.RGBA{0, 0, 0, 200}, // Semi-transparent black
-		LineWidth:   2,
-		NumberScale: 3,
+// encodeImage encodes img using config.Encoder, or as PNG with the configured compression
+// level when no encoder is set.
+func encodeImage(img image.Image, config Config) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeImage(&buf, img, config); err != nil {
+		return nil, err
 	}
+
+	return buf.Bytes(), nil
 }
 
-// AddGrid overlays a numbered grid on the provided image using the given configuration.
-// Returns the modified image as PNG bytes.
-func AddGrid(img image.Image, config Config) ([]byte, error) {
-	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
+// encodeGridded encodes the gridded rendering of src like encodeImage and embeds src when
+// config.KeepSource is set.
+func encodeGridded(gridded, src image.Image, config Config) ([]byte, error) {
+	data, err := encodeImage(gridded, config)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create a new RGBA image to draw on
-	overlay := image.NewRGBA(bounds)
-	draw.Draw(overlay, bounds, img, bounds.Min, draw.Src)
+	return embedSource(data, src, config)
+}
 
-	// Draw vertical lines
-	for x := config.CellSize; x < width; x += config.CellSize {
-		for y := 0; y < height; y++ {
-			for i := 0; i < config.LineWidth && x-i >= 0; i++ {
-				overlay.Set(x-i, y, config.GridColor)
-			}
+// writeImage encodes img to w using config.Encoder, or as PNG with the configured
+// compression level when no encoder is set. PNG output carries the configuration in a
+// tEXt chunk when EmbedConfig is set.
+func writeImage(w io.Writer, img image.Image, config Config) error {
+	defer config.Hooks.end("encode", config.Hooks.start())
+
+	if config.Encoder != nil {
+		if err := config.Encoder(w, img); err != nil {
+			return fmt.Errorf("failed to encode image with grid: %v", err)
 		}
+		return nil
 	}
 
-	// Draw horizontal lines
-	for y := config.CellSize; y < height; y += config.CellSize {
-		for x := 0; x < width; x++ {
-			for i := 0; i < config.LineWidth && y-i >= 0; i++ {
-				overlay.Set(x, y-i, config.GridColor)
-			}
+	encoder := png.Encoder{CompressionLevel: config.PNGCompression}
+	if !config.EmbedConfig {
+		if err := encoder.Encode(w, img); err != nil {
+			return fmt.Errorf("failed to encode image with grid: %v", err)
 		}
+		return nil
 	}
 
-	// Add sequential numbers in center of each cell
-	cellNumber := 0
-	for gridY := 0; gridY*config.CellSize < height; gridY++ {
-		for gridX := 0; gridX*config.CellSize < width; gridX++ {
-			// Calculate center of the cell
-			centerX := gridX*config.CellSize + config.CellSize/2
-			centerY := gridY*config.CellSize + config.CellSize/2
+	// The config chunk goes right after the image header, so encode to memory first
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode image with grid: %v", err)
+	}
+	data, err := embedConfig(buf.Bytes(), config)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to encode image with grid: %v", err)
+	}
 
-			// Only draw if center is within bounds
-			if centerX < width && centerY < height {
-				drawLargeNumber(overlay, centerX, centerY, cellNumber, config)
-			}
-			cellNumber++
+	return nil
+}
+
+// DrawVLine draws a single vertical grid line at x onto dst, using the configured GridColor,
+// LineWidth and CenteredLines placement. The color is alpha-composited over dst and pixels
+// outside dst's bounds are skipped.
+func DrawVLine(dst draw.Image, x int, config Config) {
+	if config.GridColor == nil {
+		return
+	}
+
+	bounds := dst.Bounds()
+	lead := lineLead(config)
+	for i := 0; i < config.LineWidth; i++ {
+		px := x - lead + i
+		if px < bounds.Min.X || px >= bounds.Max.X {
+			continue
+		}
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			blendPixel(dst, px, y, config.GridColor)
 		}
 	}
+}
 
-	// Encode to PNG bytes
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, overlay); err != nil {
-		return nil, fmt.Errorf("failed to encode image with grid: %v", err)
+// DrawHLine draws a single horizontal grid line at y onto dst, using the configured GridColor,
+// LineWidth and CenteredLines placement. The color is alpha-composited over dst and pixels
+// outside dst's bounds are skipped.
+func DrawHLine(dst draw.Image, y int, config Config) {
+	if config.GridColor == nil {
+		return
 	}
 
-	return buf.Bytes(), nil
+	bounds := dst.Bounds()
+	lead := lineLead(config)
+	for i := 0; i < config.LineWidth; i++ {
+		py := y - lead + i
+		if py < bounds.Min.Y || py >= bounds.Max.Y {
+			continue
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			blendPixel(dst, x, py, config.GridColor)
+		}
+	}
+}
+
+// VerticalLinePositions returns the x coordinates of the vertical grid lines AddGrid draws on an
+// image width pixels wide, in the order they are drawn: every cell boundary inside the image,
+// from cellSize upward. Pass them to DrawVLine to draw matching lines; the pixels a line covers
+// around its position depend on LineWidth and CenteredLines. Seamless and CloseGrid add lines
+// on the image edges that are not included. Returns nil if cellSize is not positive.
+func VerticalLinePositions(width, cellSize int) []int {
+	return boundaryPositions(width, cellSize)
+}
+
+// HorizontalLinePositions returns the y coordinates of the horizontal grid lines AddGrid draws
+// on an image height pixels tall, in the order they are drawn. See VerticalLinePositions.
+func HorizontalLinePositions(height, cellSize int) []int {
+	return boundaryPositions(height, cellSize)
+}
+
+// boundaryPositions returns the multiples of cellSize in (0, length).
+func boundaryPositions(length, cellSize int) []int {
+	if cellSize <= 0 {
+		return nil
+	}
+
+	var positions []int
+	for p := cellSize; p < length; p += cellSize {
+		positions = append(positions, p)
+	}
+
+	return positions
+}
+
+// ColumnRounding selects how the coordinate functions count a partial last column, i.e. when
+// the image width is not a multiple of the cell size.
+type ColumnRounding int
+
+const (
+	// FloorColumns counts only complete columns. Pixels in a partial last column map past the
+	// end of their row, so they do not round-trip through CellToPixel. This is the behavior of
+	// CellToPixel and PixelToCell.
+	FloorColumns ColumnRounding = iota
+
+	// CeilColumns counts the partial last column as a column of its own, matching the cells
+	// that AddGrid draws and numbers. Every pixel round-trips to its own cell.
+	CeilColumns
+
+	// MergeColumns counts the partial last column as a column of its own when it is at least
+	// half a cell wide, and otherwise merges it into the column before it, matching the cells
+	// that AddGrid numbers with MergePartialCells.
+	MergeColumns
+)
+
+// columnsPerRow returns the number of columns the coordinate functions use for imageWidth.
+// The result is at least 1.
+func columnsPerRow(imageWidth, cellSize int, rounding ColumnRounding) int {
+	columns := imageWidth / cellSize
+	partial := imageWidth % cellSize
+	if rounding == CeilColumns || rounding == MergeColumns && 2*partial >= cellSize {
+		columns = (imageWidth + cellSize - 1) / cellSize
+	}
+	if columns == 0 {
+		columns = 1
+	}
+
+	return columns
 }
 
 // CellToPixel converts a cell number to pixel coordinates (center of the cell).
+// If cellSize exceeds imageWidth, the single column spans the whole image width and
+// the returned x coordinate is the horizontal center of the image. The y coordinate is
+// not clamped because the image height is unknown here; PixelToCell still maps it back
+// to the same cell. For every cell number that is not negative and every positive
+// cellSize, PixelToCell returns the cell CellToPixel was given, whether cellSize is odd or
+// even; the same holds for CellToPixelRounding and PixelToCellRounding with any rounding.
 func CellToPixel(cellNumber int, imageWidth int, cellSize int) (int, int, error) {
+	return CellToPixelRounding(cellNumber, imageWidth, cellSize, FloorColumns)
+}
+
+// CellToPixelRounding is like CellToPixel but counts columns according to rounding. With
+// CeilColumns, the x coordinate of a cell in a partial last column is the center of the part
+// of the cell that lies inside the image. A cell merged with MergeColumns keeps the center of
+// its full part, where AddGrid draws its number.
+func CellToPixelRounding(cellNumber int, imageWidth int, cellSize int, rounding ColumnRounding) (int, int, error) {
 	if cellNumber < 0 {
-		return 0, 0, fmt.Errorf("invalid cell number: %d", cellNumber)
+		return 0, 0, fmt.Errorf("%w: %d", ErrNegativeCell, cellNumber)
 	}
-
-	// Calculate columns per row based on image width
-	columnsPerRow := imageWidth / cellSize
-	if columnsPerRow == 0 {
-		columnsPerRow = 1
+	if cellSize <= 0 {
+		return 0, 0, fmt.Errorf("invalid cell size: %d", cellSize)
 	}
 
+	columns := columnsPerRow(imageWidth, cellSize, rounding)
+
 	// Convert cell number to grid coordinates
-	gridX := cellNumber % columnsPerRow
-	gridY := cellNumber / columnsPerRow
+	gridX := cellNumber % columns
+	gridY := cellNumber / columns
 
 	// Calculate pixel coordinates (center of the cell)
-	pixelX := gridX*cellSize + cellSize/2
-	pixelY := gridY*cellSize + cellSize/2
+	return cellCenter(gridX, cellSize, imageWidth), cellCenter(gridY, cellSize, math.MaxInt), nil
+}
+
+// cellCenter returns the center of the part of cell grid that lies in [0, length) along an
+// axis, or the start of the cell when no part of it does. The center always lies in
+// the cell, so dividing it by cellSize gives grid back: the PixelToCell round-trip depends on
+// this. The half width is rounded down, so the center of a cell of odd size is its middle
+// pixel and that of a cell of even size the first pixel of its second half.
+func cellCenter(grid, cellSize, length int) int {
+	start := grid * cellSize
+	end := start + cellSize
+	if end > length {
+		end = max(length, start)
+	}
 
-	return pixelX, pixelY, nil
+	return start + (end-start)/2
 }
 
 // PixelToCell converts pixel coordinates to the corresponding cell number.
+// If cellSize exceeds both image dimensions, every pixel of the image lies in cell 0.
 func PixelToCell(x, y int, imageWidth int, cellSize int) int {
-	columnsPerRow := imageWidth / cellSize
-	if columnsPerRow == 0 {
-		columnsPerRow = 1
+	return pixelToCell(x, y, imageWidth, cellSize, FloorColumns)
+}
+
+// PixelToCellRounding is like PixelToCell but counts columns according to rounding. With
+// MergeColumns, pixels in a merged partial column belong to the last column.
+// Returns an error if cellSize is not positive.
+func PixelToCellRounding(x, y int, imageWidth int, cellSize int, rounding ColumnRounding) (int, error) {
+	if cellSize <= 0 {
+		return 0, fmt.Errorf("invalid cell size: %d", cellSize)
 	}
 
+	return pixelToCell(x, y, imageWidth, cellSize, rounding), nil
+}
+
+// pixelToCell returns the cell containing pixel (x, y) for a positive cellSize, counting
+// columns according to rounding.
+func pixelToCell(x, y int, imageWidth int, cellSize int, rounding ColumnRounding) int {
+	columns := columnsPerRow(imageWidth, cellSize, rounding)
+
 	gridX := x / cellSize
 	gridY := y / cellSize
+	if rounding == MergeColumns {
+		gridX = min(gridX, columns-1)
+	}
+
+	return gridY*columns + gridX
+}
+
+// PixelToCellTolerant converts pixel coordinates to a cell number like PixelToCell, using
+// config.CellSize as the cell size, but resolves clicks on grid lines consistently: a pixel
+// covered by a line drawn with config.LineWidth and config.CenteredLines belongs to the cell
+// above or to the left of that line. PixelToCell assigns the pixels of a line to the cells on
+// either side of the boundary, so thick lines can send a click on one line to two cells.
+// With config.MergePartialCells, columns are counted as with MergeColumns.
+// Returns an error if config.CellSize is not positive.
+func PixelToCellTolerant(x, y int, imageWidth int, config Config) (int, error) {
+	if config.CellSize <= 0 {
+		return 0, fmt.Errorf("invalid cell size: %d", config.CellSize)
+	}
+
+	if config.MergePartialCells {
+		columns := columnsPerRow(imageWidth, config.CellSize, MergeColumns)
+		return tolerantIndex(y, config)*columns + min(tolerantIndex(x, config), columns-1), nil
+	}
+
+	columns := columnsPerRow(imageWidth, config.CellSize, FloorColumns)
+	return tolerantIndex(y, config)*columns + tolerantIndex(x, config), nil
+}
+
+// tolerantIndex returns the column or row containing pixel p, counting pixels of the line
+// on a cell boundary toward the cell before it.
+func tolerantIndex(p int, config Config) int {
+	index := p / config.CellSize
+	past := p - index*config.CellSize
+
+	// The line on boundary index*CellSize extends this many pixels past it
+	if index > 0 && past < config.LineWidth-lineLead(config) {
+		index--
+	}
+
+	return index
+}
+
+// CellToPixelOrigin converts a cell number to the pixel coordinates of its center on an
+// imageWidth x imageHeight grid numbered from origin, as AddGrid draws it with NumberOrigin set.
+// Partial last columns and rows count as cells (see CeilColumns) and the center of a partial
+// cell is the center of its visible part. Returns an error if the cell does not exist or
+// cellSize is not positive.
+func CellToPixelOrigin(cellNumber int, imageWidth, imageHeight int, cellSize int, origin NumberOrigin) (int, int, error) {
+	if cellSize <= 0 {
+		return 0, 0, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	cell, err := cellRect(cellNumber, image.Rect(0, 0, imageWidth, imageHeight), cellSize, origin, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return (cell.Min.X + cell.Max.X) / 2, (cell.Min.Y + cell.Max.Y) / 2, nil
+}
+
+// PixelToCellOrigin converts pixel coordinates to the number of the cell containing them on an
+// imageWidth x imageHeight grid numbered from origin. It is the inverse of CellToPixelOrigin.
+// Returns an error if cellSize is not positive.
+func PixelToCellOrigin(x, y int, imageWidth, imageHeight int, cellSize int, origin NumberOrigin) (int, error) {
+	if cellSize <= 0 {
+		return 0, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	columns, rows := gridDimensions(imageWidth, imageHeight, cellSize)
+	return cellNumberAt(x/cellSize, y/cellSize, columns, rows, origin), nil
+}
+
+// RoundMode selects how QuantizePoint snaps a coordinate to the cell boundaries.
+type RoundMode int
+
+const (
+	// RoundDown snaps to the boundary at or before the coordinate, i.e. the start of the cell
+	// containing it, like the floor division of PixelToCell.
+	RoundDown RoundMode = iota
+
+	// RoundNearest snaps to the closest boundary. A coordinate exactly halfway between two
+	// boundaries snaps to the later one.
+	RoundNearest
+
+	// RoundUp snaps to the boundary at or after the coordinate.
+	RoundUp
+)
+
+// QuantizePoint snaps the point (x, y) to the grid lines of a grid with the given cell size,
+// returning the boundary coordinates chosen by mode on each axis. Boundaries lie at multiples
+// of cellSize, so coordinates already on a boundary are returned unchanged. Negative
+// coordinates snap like positive ones. If cellSize is not positive, the point is returned
+// unchanged.
+func QuantizePoint(x, y, cellSize int, mode RoundMode) (int, int) {
+	if cellSize <= 0 {
+		return x, y
+	}
+
+	return quantize(x, cellSize, mode), quantize(y, cellSize, mode)
+}
+
+// quantize snaps p to a multiple of cellSize according to mode.
+func quantize(p, cellSize int, mode RoundMode) int {
+	down := p / cellSize * cellSize
+	if down > p {
+		down -= cellSize // Division truncates toward zero
+	}
+
+	switch {
+	case down == p:
+		return p
+	case mode == RoundUp, mode == RoundNearest && 2*(p-down) >= cellSize:
+		return down + cellSize
+	default:
+		return down
+	}
+}
+
+// NormalizedToCell converts a point given in normalized coordinates, where (0, 0) is the
+// top-left and (1, 1) the bottom-right corner of the image, to the cell it falls in. The point
+// is mapped to the pixel it covers and then passed to PixelToCell, so the result always agrees
+// with the pixel math; u or v of exactly 1 selects the last pixel column or row.
+// Returns an error if u or v is outside [0, 1] or cellSize is not positive.
+func NormalizedToCell(u, v float64, imageWidth, imageHeight, cellSize int) (int, error) {
+	if !(u >= 0 && u <= 1) || !(v >= 0 && v <= 1) {
+		return 0, fmt.Errorf("normalized point (%g, %g) outside [0, 1]", u, v)
+	}
+	if cellSize <= 0 {
+		return 0, fmt.Errorf("invalid cell size: %d", cellSize)
+	}
+
+	return PixelToCell(denormalize(u, imageWidth), denormalize(v, imageHeight), imageWidth, cellSize), nil
+}
+
+// denormalize maps t in [0, 1] to a pixel index in [0, size).
+func denormalize(t float64, size int) int {
+	p := int(t * float64(size))
+	if p >= size {
+		p = size - 1
+	}
+	if p < 0 {
+		p = 0
+	}
+
+	return p
+}
+
+// CellSizeForCount returns a square cell size that divides a width x height image into
+// approximately targetCells cells. The actual cell count will be near, but rarely exactly,
+// the target because cells are whole pixels and partial edge cells are counted too.
+// The result is at least 1; a non-positive targetCells is treated as 1.
+func CellSizeForCount(width, height, targetCells int) int {
+	if targetCells < 1 {
+		targetCells = 1
+	}
 
-	return gridY*columnsPerRow + gridX
-}
-
-// getDigitPattern returns a 5x7 bitmap pattern for digits 0-9.
-func getDigitPattern(digit rune) []string {
-	patterns := map[rune][]string{
-		'0': {
-			" ### ",
-			"#   #",
-			"#   #",
-			"#   #",
-			"#   #",
-			"#   #",
-			" ### ",
-		},
-		'1': {
-			"  #  ",
-			" ##  ",
-			"  #  ",
-			"  #  ",
-			"  #  ",
-			"  #  ",
-			"#####",
-		},
-		'2': {
-			" ### ",
-			"#   #",
-			"    #",
-			"   # ",
-			"  #  ",
-			" #   ",
-			"#####",
-		},
-		'3': {
-			" ### ",
-			"#   #",
-			"    #",
-			"  ## ",
-			"    #",
-			"#   #",
-			" ### ",
-		},
-		'4': {
-			"   # ",
-			"  ## ",
-			" # # ",
-			"#  # ",
-			"#####",
-			"   # ",
-			"   # ",
-		},
-		'5': {
-			"#####",
-			"#    ",
-			"#    ",
-			"#### ",
-			"    #",
-			"#   #",
-			" ### ",
-		},
-		'6': {
-			" ### ",
-			"#   #",
-			"#    ",
-			"#### ",
-			"#   #",
-			"#   #",
-			" ### ",
-		},
-		'7': {
-			"#####",
-			"    #",
-			"   # ",
-			"  #  ",
-			" #   ",
-			" #   ",
-			" #   ",
-		},
-		'8': {
-			" ### ",
-			"#   #",
-			"#   #",
-			" ### ",
-			"#   #",
-			"#   #",
-			" ### ",
-		},
-		'9': {
-			" ### ",
-			"#   #",
-			"#   #",
-			" ####",
-			"    #",
-			"#   #",
-			" ### ",
-		},
-	}
-
-	if pattern, ok := patterns[digit]; ok {
-		return pattern
-	}
-	return []string{} // Return empty pattern for unknown digits
-}
-
-// drawLargeNumber draws a number at the specified position with large, readable digits.
-func drawLargeNumber(img draw.Image, x, y int, number int, config Config) {
-	numStr := fmt.Sprintf("%d", number)
+	size := int(math.Round(math.Sqrt(float64(width) * float64(height) / float64(targetCells))))
+	if size < 1 {
+		size = 1
+	}
+
+	return size
+}
+
+// CellSizeForLabelDensity returns the cell size that fits about targetLabelsAcross cells, and
+// so labels, across an image width pixels wide: width divided by targetLabelsAcross, at least
+// 1. A non-positive targetLabelsAcross is treated as 1. Combine it with LabelEvery to thin out
+// the labels further without changing the grid.
+func CellSizeForLabelDensity(width, targetLabelsAcross int) int {
+	if targetLabelsAcross < 1 {
+		targetLabelsAcross = 1
+	}
+
+	return max(width/targetLabelsAcross, 1)
+}
+
+// CellSizeFromInches converts a physical cell size in inches to pixels at the given DPI,
+// rounded to the nearest pixel. The result is at least 1.
+func CellSizeFromInches(inches float64, dpi int) int {
+	size := int(math.Round(inches * float64(dpi)))
+	if size < 1 {
+		size = 1
+	}
+
+	return size
+}
+
+// CellSizeFromMM converts a physical cell size in millimeters to pixels at the given DPI,
+// rounded to the nearest pixel. The result is at least 1.
+func CellSizeFromMM(mm float64, dpi int) int {
+	return CellSizeFromInches(mm/25.4, dpi)
+}
+
+// shouldLabel reports whether a cell gets a label drawn. With LabelEvery > 1 only
+// every LabelEvery-th cell is labeled, and cells in ExcludeCells are never labeled.
+func shouldLabel(cellNumber int, config Config) bool {
+	if config.ExcludeCells[cellNumber] {
+		return false
+	}
+	return config.LabelEvery <= 1 || cellNumber%config.LabelEvery == 0
+}
+
+// CellLabel returns the label text the grid draws for a cell, so tooltips and other UI can match
+// the rendered image exactly. col and row are the cell's grid position, counted from the
+// NumberOrigin corner (cellNumber%columns and cellNumber/columns). The label is the cell
+// number (the column with ResetPerRow), or that number times ValuePerCell formatted with
+// ValueFormat when ValuePerCell is set, wrapped in NumberPrefix and NumberSuffix. A cell listed
+// in CellLabels gets its custom label instead, as is. CellLabel does not consider LabelEvery or
+// HideNumbers, which only decide whether it is drawn.
+func CellLabel(cellNumber, col, row int, config Config) string {
+	if label, ok := config.CellLabels[cellNumber]; ok {
+		return label
+	}
+
+	number := cellNumber
+	if config.ResetPerRow {
+		number = col
+	}
+
+	text := fmt.Sprintf("%d", number)
+	if config.ValuePerCell != 0 {
+		value := float64(number) * config.ValuePerCell
+		if value == 0 {
+			value = 0 // Avoid rendering negative zero as "-0"
+		}
+		if config.ValueFormat == "" {
+			// Rounding to 10 significant digits hides noise like 3 * 0.1 = 0.30000000000000004,
+			// and the 'f' format never switches to an exponent
+			value, _ = strconv.ParseFloat(strconv.FormatFloat(value, 'g', 10, 64), 64)
+			text = strconv.FormatFloat(value, 'f', -1, 64)
+		} else {
+			text = fmt.Sprintf(config.ValueFormat, value)
+		}
+	}
+
+	return config.NumberPrefix + text + config.NumberSuffix
+}
+
+// DrawLabel renders text centered at (x, y) using the same look as the grid's cell numbers:
+// a background box in config.NumberBG with glyphs in config.NumberColor scaled by config.NumberScale
+// or sized by config.NumberPixelHeight. Characters without a glyph are rendered as blank space.
+// A nil NumberBG or NumberColor leaves out the background or the glyphs. Pixels outside dst's
+// bounds are skipped.
+func DrawLabel(dst draw.Image, x, y int, text string, config Config) {
+	if text == "" {
+		return
+	}
+
+	config = scaledLabel(config)
+
+	padding := 2 * config.NumberScale
+	totalWidth, totalHeight := MeasureLabel(text, config)
+
+	// Center the label block
+	startX := x - totalWidth/2
+	startY := y - totalHeight/2
+	bounds := dst.Bounds()
+
+	if config.AutoContrastNumbers {
+		region := image.Rect(startX, startY, startX+totalWidth, startY+totalHeight)
+		config.NumberColor, config.NumberBG = contrastColors(dst, region, config.NumberBG)
+	}
+
+	// Composite the background rectangle, skipping it entirely when it is fully transparent
+	if config.NumberBG != nil && !isTransparent(config.NumberBG) {
+		for dx := 0; dx < totalWidth; dx++ {
+			for dy := 0; dy < totalHeight; dy++ {
+				px := startX + dx
+				py := startY + dy
+				if image.Pt(px, py).In(bounds) {
+					blendPixel(dst, px, py, config.NumberBG)
+				}
+			}
+		}
+	}
+
+	// Draw the shadow first so the digits end up on top of it
+	if config.NumberShadow && config.NumberShadowColor != nil {
+		offset := (config.NumberScale + 1) / 2
+		drawDigits(dst, startX+padding+offset, startY+padding+offset, text, config.NumberShadowColor, config)
+	}
+
+	if config.NumberColor != nil {
+		drawDigits(dst, startX+padding, startY+padding, text, config.NumberColor, config)
+	}
+}
+
+// contrastColors picks black or white label colors for the given region of img based on its
+// average luminance: dark text on a light background over bright content and vice versa.
+// The background keeps the alpha of bg so its translucency is preserved.
+func contrastColors(img image.Image, region image.Rectangle, bg color.Color) (color.Color, color.Color) {
+	region = region.Intersect(img.Bounds())
+
+	var sum, count uint64
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for x := region.Min.X; x < region.Max.X; x++ {
+			sum += uint64(color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y)
+			count++
+		}
+	}
+
+	var bgAlpha uint8 = 0xff
+	if bg != nil {
+		_, _, _, a := bg.RGBA()
+		bgAlpha = uint8(a >> 8)
+	}
+
+	if count > 0 && sum/count > 0x7fff {
+		return color.RGBA{0, 0, 0, 255}, color.RGBA{bgAlpha, bgAlpha, bgAlpha, bgAlpha}
+	}
+	return color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, bgAlpha}
+}
+
+// MeasureLabel returns the pixel dimensions of the label block DrawLabel renders for text
+// under config, including the background padding and the spacing between characters and
+// between wrapped lines, so callers can reserve room for legends, margins and annotations
+// before drawing. Shadows and NumberWeight can extend the glyphs slightly past this block.
+func MeasureLabel(text string, config Config) (width, height int) {
+	if text == "" {
+		return 0, 0
+	}
+
+	config = scaledLabel(config)
 
 	// Size settings
 	digitWidth := 5 * config.NumberScale
@@ -233,47 +1732,235 @@ func drawLargeNumber(img draw.Image, x, y int, number int, config Config) {
 	spacing := 2 * config.NumberScale
 	padding := 2 * config.NumberScale
 
-	// Calculate total width needed
-	totalWidth := len(numStr)*digitWidth + (len(numStr)-1)*spacing + 2*padding
-	totalHeight := digitHeight + 2*padding
+	// Calculate total size needed
+	lines := wrapLabel(text, config)
+	length := longestLine(lines)
+	totalWidth := length*digitWidth + (length-1)*spacing + 2*padding
+	totalHeight := len(lines)*digitHeight + (len(lines)-1)*spacing + 2*padding
 
-	// Center the number block
-	startX := x - totalWidth/2
-	startY := y - totalHeight/2
+	return totalWidth, totalHeight
+}
+
+// wrapLabel splits text into the lines it is drawn on: two stacked lines when it has more
+// than WrapLabelAt characters, the first one taking the extra character of an odd count, and
+// a single line otherwise.
+func wrapLabel(text string, config Config) []string {
+	length := utf8.RuneCountInString(text)
+	if config.WrapLabelAt <= 0 || length <= config.WrapLabelAt {
+		return []string{text}
+	}
+
+	runes := []rune(text)
+	half := (length + 1) / 2
+	return []string{string(runes[:half]), string(runes[half:])}
+}
+
+// longestLine returns the character count of the longest of lines.
+func longestLine(lines []string) int {
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, utf8.RuneCountInString(line))
+	}
+
+	return longest
+}
+
+// fillCircle draws a filled circle of the given radius centered at (cx, cy),
+// alpha-compositing c over the image. A nil color draws nothing.
+func fillCircle(img draw.Image, cx, cy, radius int, c color.Color) {
+	if c == nil {
+		return
+	}
 
-	// Draw background rectangle
-	for dx := 0; dx < totalWidth; dx++ {
-		for dy := 0; dy < totalHeight; dy++ {
-			px := startX + dx
-			py := startY + dy
-			if px >= 0 && py >= 0 && px < img.Bounds().Max.X && py < img.Bounds().Max.Y {
-				img.Set(px, py, config.NumberBG)
+	bounds := img.Bounds()
+	for y := cy - radius; y <= cy+radius; y++ {
+		for x := cx - radius; x <= cx+radius; x++ {
+			dx, dy := x-cx, y-cy
+			if dx*dx+dy*dy <= radius*radius && image.Pt(x, y).In(bounds) {
+				blendPixel(img, x, y, c)
 			}
 		}
 	}
+}
+
+// drawDigits renders the glyph patterns of text starting at the given top-left position,
+// wrapped with WrapLabelAt into lines that are centered on the longest one. The glyph pixels,
+// thickened by NumberWeight, are collected from the glyph cache into a mask first, and each
+// pixel is then alpha-composited over the existing image content exactly once.
+func drawDigits(img draw.Image, x, y int, text string, c color.Color, config Config) {
+	digitWidth := 5 * config.NumberScale
+	digitHeight := 7 * config.NumberScale
+	spacing := 2 * config.NumberScale
+	weight := config.NumberWeight
+	if weight < 0 {
+		weight = 0
+	}
 
-	// Draw each digit
-	for i, digit := range numStr {
-		pattern := getDigitPattern(digit)
-		digitX := startX + padding + i*(digitWidth+spacing)
-		digitY := startY + padding
-
-		// Draw the pattern
-		for row, line := range pattern {
-			for col, char := range line {
-				if char == '#' {
-					// Draw a scaled block for each '#'
-					for sx := 0; sx < config.NumberScale; sx++ {
-						for sy := 0; sy < config.NumberScale; sy++ {
-							px := digitX + col*config.NumberScale + sx
-							py := digitY + row*config.NumberScale + sy
-							if px >= 0 && py >= 0 && px < img.Bounds().Max.X && py < img.Bounds().Max.Y {
-								img.Set(px, py, config.NumberColor)
-							}
+	lines := wrapLabel(text, config)
+	length := longestLine(lines)
+	area := image.Rect(x, y, x+length*(digitWidth+spacing), y+len(lines)*(digitHeight+spacing)).Inset(-weight)
+	glyphs := image.NewAlpha(area)
+
+	// Combine the cached glyph masks first, so pixels where thickened glyphs overlap are
+	// blended only once
+	for row, line := range lines {
+		lineX := x + (length-utf8.RuneCountInString(line))*(digitWidth+spacing)/2
+		lineY := y + row*(digitHeight+spacing)
+		i := 0
+		for _, digit := range line {
+			digitX := lineX + i*(digitWidth+spacing)
+			if mask := glyphMask(digit, config.NumberScale, weight); mask != nil {
+				r := mask.Bounds()
+				for py := r.Min.Y; py < r.Max.Y; py++ {
+					for px := r.Min.X; px < r.Max.X; px++ {
+						if mask.AlphaAt(px, py).A != 0 {
+							glyphs.SetAlpha(digitX+px, lineY+py, color.Alpha{A: 0xff})
 						}
 					}
 				}
 			}
+			i++
+		}
+	}
+
+	bounds := img.Bounds()
+	for py := area.Min.Y; py < area.Max.Y; py++ {
+		for px := area.Min.X; px < area.Max.X; px++ {
+			if glyphs.AlphaAt(px, py).A != 0 && image.Pt(px, py).In(bounds) {
+				blendPixel(img, px, py, c)
+			}
+		}
+	}
+}
+
+// dilate returns a copy of mask in which every set pixel is grown into a square reaching
+// radius pixels in each direction. The result keeps the bounds of mask.
+func dilate(mask *image.Alpha, radius int) *image.Alpha {
+	bounds := mask.Bounds()
+
+	// The square is separable: grow horizontally, then vertically
+	wide := image.NewAlpha(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if mask.AlphaAt(x, y).A != 0 {
+				for dx := -radius; dx <= radius; dx++ {
+					wide.SetAlpha(x+dx, y, color.Alpha{A: 0xff})
+				}
+			}
+		}
+	}
+
+	grown := image.NewAlpha(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if wide.AlphaAt(x, y).A != 0 {
+				for dy := -radius; dy <= radius; dy++ {
+					grown.SetAlpha(x, y+dy, color.Alpha{A: 0xff})
+				}
+			}
 		}
 	}
-}
\ No newline at end of file
+
+	return grown
+}
+
+// blendPixel composites c over the pixel at (x, y) using the Porter-Duff "over" operator.
+func blendPixel(img draw.Image, x, y int, c color.Color) {
+	sr, sg, sb, sa := c.RGBA()
+	if sa == 0xffff {
+		img.Set(x, y, c)
+		return
+	}
+	if sa == 0 {
+		return
+	}
+
+	dr, dg, db, da := img.At(x, y).RGBA()
+	r, g, b, a := over(sr, sg, sb, sa, dr, dg, db, da)
+	img.Set(x, y, color.RGBA64{R: r, G: g, B: b, A: a})
+}
+
+// compositeMask composites c over dst wherever mask is non-zero, scaling the
+// color's coverage by the mask's alpha.
+func compositeMask(dst *image.RGBA, mask *image.Alpha, c color.Color) {
+	if c == nil {
+		return
+	}
+	cr, cg, cb, ca := c.RGBA()
+	if ca == 0 {
+		return
+	}
+
+	bounds := dst.Bounds().Intersect(mask.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			m := uint32(mask.AlphaAt(x, y).A) * 0x101
+			if m == 0 {
+				continue
+			}
+
+			i := dst.PixOffset(x, y)
+			pix := dst.Pix[i : i+4 : i+4]
+			r, g, b, a := over(cr*m/0xffff, cg*m/0xffff, cb*m/0xffff, ca*m/0xffff,
+				uint32(pix[0])*0x101, uint32(pix[1])*0x101, uint32(pix[2])*0x101, uint32(pix[3])*0x101)
+			pix[0], pix[1], pix[2], pix[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+		}
+	}
+}
+
+// compositeImage composites the part of src starting at sp over the rectangle r of dst, like
+// draw.Draw with draw.Over. It uses the same arithmetic as the grid itself, which also clamps
+// colors that are not validly premultiplied, such as the default GridColor. Fully transparent
+// source pixels are skipped.
+func compositeImage(dst *image.RGBA, src *image.RGBA, r image.Rectangle, sp image.Point) {
+	offset := sp.Sub(r.Min)
+	r = r.Intersect(dst.Bounds()).Intersect(src.Bounds().Sub(offset))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := src.PixOffset(x+offset.X, y+offset.Y)
+			s := src.Pix[i : i+4 : i+4]
+			if s[0]|s[1]|s[2]|s[3] == 0 {
+				continue
+			}
+
+			j := dst.PixOffset(x, y)
+			d := dst.Pix[j : j+4 : j+4]
+			cr, cg, cb, ca := over(uint32(s[0])*0x101, uint32(s[1])*0x101, uint32(s[2])*0x101, uint32(s[3])*0x101,
+				uint32(d[0])*0x101, uint32(d[1])*0x101, uint32(d[2])*0x101, uint32(d[3])*0x101)
+			d[0], d[1], d[2], d[3] = uint8(cr>>8), uint8(cg>>8), uint8(cb>>8), uint8(ca>>8)
+		}
+	}
+}
+
+// over composites the premultiplied source color over the destination color.
+func over(sr, sg, sb, sa, dr, dg, db, da uint32) (uint16, uint16, uint16, uint16) {
+	inv := 0xffff - sa
+	return clamp16(sr + dr*inv/0xffff),
+		clamp16(sg + dg*inv/0xffff),
+		clamp16(sb + db*inv/0xffff),
+		clamp16(sa + da*inv/0xffff)
+}
+
+// isOpaque reports whether c is not nil and has full alpha.
+func isOpaque(c color.Color) bool {
+	if c == nil {
+		return false
+	}
+	_, _, _, a := c.RGBA()
+	return a == 0xffff
+}
+
+// isTransparent reports whether c has zero alpha.
+func isTransparent(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a == 0
+}
+
+// clamp16 limits v to the 16-bit color channel range. Colors that are not
+// properly alpha-premultiplied can otherwise overflow when composited.
+func clamp16(v uint32) uint16 {
+	if v > 0xffff {
+		return 0xffff
+	}
+	return uint16(v)
+}
@@ -0,0 +1,1039 @@
+package imgrid
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/dmahlow/imgrid/imgridtest"
+)
+
+func TestEmptyImage(t *testing.T) {
+	config := DefaultConfig()
+	red := color.RGBA{255, 0, 0, 255}
+
+	for _, size := range []image.Point{{0, 0}, {0, 100}, {100, 0}} {
+		img := image.NewRGBA(image.Rectangle{Max: size})
+		calls := map[string]func() error{
+			"AddGrid": func() error { _, err := AddGrid(img, config); return err },
+			"AddGridWithLabels": func() error {
+				_, err := AddGridWithLabels(img, []string{"A"}, config)
+				return err
+			},
+			"AddGridLayered": func() error { _, err := AddGridLayered(img, []Config{config}); return err },
+			"AddGrids":       func() error { _, err := AddGrids(img, []Config{config}); return err },
+			"AddGridReuse":   func() error { return AddGridReuse(image.NewRGBA(img.Rect), img, config) },
+			"RenderPixels":   func() error { _, err := RenderPixels(img, config); return err },
+			"SpotlightCell":  func() error { _, err := SpotlightCell(img, 0, red, config); return err },
+			"HighlightCell":  func() error { _, err := HighlightCell(img, 0, red, config); return err },
+			"AddGridLayers":  func() error { _, _, _, err := AddGridLayers(img, config); return err },
+			"AddGridMasked":  func() error { _, err := AddGridMasked(img, img, config); return err },
+			"AddGridSweepGIF": func() error {
+				_, err := AddGridSweepGIF(img, nil, red, 10, config)
+				return err
+			},
+			"CellContactSheet": func() error { _, err := CellContactSheet(img, 50, config); return err },
+			"AddGridClippedPolygon": func() error {
+				_, err := AddGridClippedPolygon(img, []image.Point{{0, 0}, {10, 0}, {0, 10}}, config)
+				return err
+			},
+			"AddGridCustomLines": func() error { _, err := AddGridCustomLines(img, nil, nil, config); return err },
+			"GridMask":           func() error { _, err := GridMask(size.X, size.Y, config); return err },
+			"NewGridImage":       func() error { _, err := NewGridImage(size.X, size.Y, config); return err },
+		}
+
+		for name, call := range calls {
+			if err := call(); err == nil {
+				t.Errorf("%s(%dx%d): expected error, got nil", name, size.X, size.Y)
+			}
+		}
+	}
+}
+
+func TestGridWriteToMatchesAddGrid(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 250, 150))
+	config := Config{KeepSource: true}
+
+	want, err := AddGrid(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := NewGrid(img, config).WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) || !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteTo wrote %d bytes that differ from AddGrid's %d", n, len(want))
+	}
+
+	if _, err := NewGrid(image.NewRGBA(image.Rect(0, 0, 0, 10)), config).WriteTo(&buf); err == nil {
+		t.Error("WriteTo on an empty image: expected error, got nil")
+	}
+}
+
+func TestKeepSourceEntryPoints(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 250, 150))
+	config := DefaultConfig()
+	config.KeepSource = true
+	red := color.RGBA{255, 0, 0, 255}
+
+	calls := map[string]func() ([]byte, error){
+		"AddGridWithLabels": func() ([]byte, error) { return AddGridWithLabels(img, []string{"A"}, config) },
+		"AddGridLayered":    func() ([]byte, error) { return AddGridLayered(img, []Config{config, config}) },
+		"AddGrids": func() ([]byte, error) {
+			variants, err := AddGrids(img, []Config{config})
+			if err != nil {
+				return nil, err
+			}
+			return variants[0], nil
+		},
+		"HighlightCell": func() ([]byte, error) { return HighlightCell(img, 1, red, config) },
+		"SpotlightCell": func() ([]byte, error) { return SpotlightCell(img, 1, red, config) },
+		"AddGridMasked": func() ([]byte, error) { return AddGridMasked(img, img, config) },
+		"AddGridClippedPolygon": func() ([]byte, error) {
+			return AddGridClippedPolygon(img, []image.Point{{0, 0}, {100, 0}, {0, 100}}, config)
+		},
+		"AddGridCustomLines": func() ([]byte, error) { return AddGridCustomLines(img, []int{50}, []int{50}, config) },
+	}
+
+	for name, call := range calls {
+		data, err := call()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := RemoveGrid(data); err != nil {
+			t.Errorf("%s: source not kept: %v", name, err)
+		}
+	}
+}
+
+func TestCellHighlightZeroConfig(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 250, 150))
+	red := color.RGBA{255, 0, 0, 255}
+
+	if _, err := HighlightCell(img, 1, red, Config{}); err != nil {
+		t.Errorf("HighlightCell: %v", err)
+	}
+	if _, err := SpotlightCell(img, 1, red, Config{}); err != nil {
+		t.Errorf("SpotlightCell: %v", err)
+	}
+	if _, err := HighlightCell(img, 1, red, Config{CellSize: -10}); err == nil {
+		t.Error("HighlightCell with negative cell size: expected error, got nil")
+	}
+}
+
+func TestPlanGridZeroConfig(t *testing.T) {
+	plan, err := PlanGrid(250, 150, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Columns != 3 || plan.Rows != 2 {
+		t.Errorf("PlanGrid(250, 150, Config{}) = %dx%d cells, want 3x2", plan.Columns, plan.Rows)
+	}
+}
+
+func TestCellLabelDefaultValueFormat(t *testing.T) {
+	tests := []struct {
+		cell  int
+		value float64
+		want  string
+	}{
+		{3, 0.1, "0.3"},
+		{0, -0.5, "0"},
+		{7, 0.5, "3.5"},
+		{3, 1e21, "3000000000000000000000"},
+		{-2, 1.5, "-3"},
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.ValuePerCell = tt.value
+		if got := CellLabel(tt.cell, tt.cell, 0, config); got != tt.want {
+			t.Errorf("CellLabel(%d) with ValuePerCell %g = %q, want %q", tt.cell, tt.value, got, tt.want)
+		}
+	}
+
+	config := DefaultConfig()
+	config.ValuePerCell = 1
+	config.ValueFormat = "%+g"
+	for _, r := range CellLabel(3, 3, 0, config) {
+		if _, ok := glyphPatterns[r]; !ok {
+			t.Errorf("no glyph for %q", r)
+		}
+	}
+}
+
+// benchmarkAddGrid renders a Full HD grid with the given line color. It uses RenderPixels so
+// PNG encoding, which is the same for both paths, does not hide the difference.
+func benchmarkAddGrid(b *testing.B, gridColor color.Color) {
+	img := image.NewRGBA(image.Rect(0, 0, 1920, 1080))
+	config := DefaultConfig()
+	config.GridColor = gridColor
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := RenderPixels(img, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkAddGridOpaque measures the fast path that writes opaque grid lines directly.
+func BenchmarkAddGridOpaque(b *testing.B) {
+	benchmarkAddGrid(b, color.RGBA{0, 255, 255, 255})
+}
+
+// BenchmarkAddGridTranslucent measures the path that composites semi-transparent lines.
+func BenchmarkAddGridTranslucent(b *testing.B) {
+	benchmarkAddGrid(b, color.RGBA{0, 255, 255, 100})
+}
+
+// FuzzRoundTrip checks that PixelToCellRounding maps the pixel CellToPixelRounding returns for
+// a cell back to that cell, for every cell of the first three rows under every rounding.
+func FuzzRoundTrip(f *testing.F) {
+	for _, width := range []int{1, 7, 99, 100, 101, 255, 640, 650} {
+		for _, cellSize := range []int{1, 2, 3, 7, 33, 64, 99, 100, 101} {
+			f.Add(width, cellSize)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, width, cellSize int) {
+		if width <= 0 || width > 4096 || cellSize <= 0 || cellSize > 4096 {
+			t.Skip()
+		}
+
+		columns := (width + cellSize - 1) / cellSize
+		for _, rounding := range []ColumnRounding{FloorColumns, CeilColumns, MergeColumns} {
+			for cell := 0; cell < 3*columns; cell++ {
+				x, y, err := CellToPixelRounding(cell, width, cellSize, rounding)
+				if err != nil {
+					t.Fatalf("cell %d (width %d, cell size %d, rounding %d): %v", cell, width, cellSize, rounding, err)
+				}
+				got, err := PixelToCellRounding(x, y, width, cellSize, rounding)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != cell {
+					t.Errorf("cell %d (width %d, cell size %d, rounding %d): pixel (%d, %d) maps to cell %d", cell, width, cellSize, rounding, x, y, got)
+				}
+			}
+		}
+	})
+}
+
+func TestCellToPixelOriginCorners(t *testing.T) {
+	// 650x250 with CellSize 100: 7 columns (the last 50 pixels wide) and 3 rows (the last 50
+	// pixels high)
+	tests := []struct {
+		origin NumberOrigin
+		x, y   int
+	}{
+		{TopLeft, 50, 50},
+		{TopRight, 625, 50},
+		{BottomLeft, 50, 225},
+		{BottomRight, 625, 225},
+	}
+
+	for _, tt := range tests {
+		x, y, err := CellToPixelOrigin(0, 650, 250, 100, tt.origin)
+		if err != nil {
+			t.Fatalf("origin %d: %v", tt.origin, err)
+		}
+		if x != tt.x || y != tt.y {
+			t.Errorf("origin %d: cell 0 at (%d, %d), want (%d, %d)", tt.origin, x, y, tt.x, tt.y)
+		}
+
+		for cell := 0; cell < 21; cell++ {
+			x, y, err := CellToPixelOrigin(cell, 650, 250, 100, tt.origin)
+			if err != nil {
+				t.Fatalf("origin %d, cell %d: %v", tt.origin, cell, err)
+			}
+			got, err := PixelToCellOrigin(x, y, 650, 250, 100, tt.origin)
+			if err != nil {
+				t.Fatalf("origin %d, cell %d: %v", tt.origin, cell, err)
+			}
+			if got != cell {
+				t.Errorf("origin %d: cell %d maps to pixel (%d, %d), which maps back to cell %d", tt.origin, cell, x, y, got)
+			}
+		}
+	}
+
+	if _, _, err := CellToPixelOrigin(0, 650, 250, 0, TopLeft); err == nil {
+		t.Error("CellToPixelOrigin with cell size 0: expected error, got nil")
+	}
+	if _, err := PixelToCellOrigin(0, 0, 650, 250, 0, TopLeft); err == nil {
+		t.Error("PixelToCellOrigin with cell size 0: expected error, got nil")
+	}
+}
+
+func TestPixelToCellTolerantThickLines(t *testing.T) {
+	// Clicks on every pixel of the line on the boundary at x = 100 resolve to cell 0
+	tests := []struct {
+		lineWidth int
+		centered  bool
+		x         int
+		want      int
+	}{
+		{5, false, 96, 0},  // First pixel of the line
+		{5, false, 100, 0}, // Last pixel of the line, on the boundary
+		{5, false, 101, 1}, // First pixel past the line
+		{5, true, 98, 0},   // First pixel of the centered line
+		{5, true, 102, 0},  // Last pixel of the centered line
+		{5, true, 103, 1},
+		{4, true, 101, 0},
+		{4, true, 102, 1},
+		{1, false, 100, 0},
+		{1, false, 101, 1},
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.LineWidth = tt.lineWidth
+		config.CenteredLines = tt.centered
+		got, err := PixelToCellTolerant(tt.x, 50, 300, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("LineWidth %d, centered %v: pixel x %d in cell %d, want %d", tt.lineWidth, tt.centered, tt.x, got, tt.want)
+		}
+
+		// The same holds for horizontal lines, where cells change by a whole row
+		got, err = PixelToCellTolerant(50, tt.x, 300, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want*3 {
+			t.Errorf("LineWidth %d, centered %v: pixel y %d in cell %d, want %d", tt.lineWidth, tt.centered, tt.x, got, tt.want*3)
+		}
+	}
+
+	if _, err := PixelToCellTolerant(10, 10, 300, Config{}); err == nil {
+		t.Error("PixelToCellTolerant with cell size 0: expected error, got nil")
+	}
+}
+
+func TestMergedSliverCellRect(t *testing.T) {
+	// 620x300 with CellSize 100: the 20 pixel sliver on the right is merged into column 5, so
+	// each row has 6 cells and cell 6 starts the second row
+	red := color.RGBA{255, 0, 0, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 620, 300))
+	config := DefaultConfig()
+	config.MergePartialCells = true
+	config.CellBackgrounds = map[int]color.Color{6: red}
+	config.GridColor = color.Transparent
+	config.NumberBG = color.Transparent
+	config.NumberColor = color.Transparent
+
+	out, err := RenderPixels(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.RGBAAt(610, 50); got == red {
+		t.Error("sliver in row 0 filled as cell 6")
+	}
+	if got := out.RGBAAt(50, 150); got != red {
+		t.Errorf("first cell of row 1 = %v, want %v", got, red)
+	}
+
+	cell, err := cellRect(5, img.Bounds(), 100, TopLeft, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := image.Rect(500, 0, 620, 100); cell != want {
+		t.Errorf("merged cell 5 = %v, want %v", cell, want)
+	}
+	if _, err := cellRect(18, img.Bounds(), 100, TopLeft, true); err == nil {
+		t.Error("cell 18 of a merged 6x3 grid: expected error, got nil")
+	}
+}
+
+func TestCellBackgrounds(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	config := DefaultConfig()
+	config.CanvasColor = white
+	config.NumberBG = color.Transparent
+	config.NumberColor = color.Transparent
+	config.CellBackgrounds = map[int]color.Color{0: red, 4: blue, 99: red}
+
+	out, err := RenderPixels(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sample the cell centers, away from the lines: 3 columns and 2 rows
+	want := map[int]color.RGBA{0: red, 1: white, 2: white, 3: white, 4: blue, 5: white}
+	for cell, c := range want {
+		x, y := cell%3*100+50, cell/3*100+50
+		if got := out.RGBAAt(x, y); got != c {
+			t.Errorf("cell %d center (%d, %d) = %v, want %v", cell, x, y, got, c)
+		}
+	}
+}
+
+func TestIntersectionOpacity(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	config := DefaultConfig()
+	config.CanvasColor = color.White
+	config.GridColor = color.NRGBA{0, 0, 255, 100}
+
+	out, err := RenderPixels(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Where the lines at x = 100 and y = 100 cross, the color is composited once, so the
+	// intersection is no darker than the middle of either line
+	intersection := out.RGBAAt(100, 100)
+	for _, p := range []image.Point{{100, 50}, {50, 100}} {
+		if got := out.RGBAAt(p.X, p.Y); got != intersection {
+			t.Errorf("line pixel %v = %v, intersection = %v", p, got, intersection)
+		}
+	}
+	if intersection == (color.RGBA{255, 255, 255, 255}) {
+		t.Error("no line drawn at the intersection")
+	}
+}
+
+func TestNRGBAMatchesRGBA(t *testing.T) {
+	bounds := image.Rect(0, 0, 250, 150)
+	nrgba := image.NewNRGBA(bounds)
+	rgba := image.NewRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBA{uint8(x), uint8(y), uint8(x + y), uint8(x * y)}
+			nrgba.SetNRGBA(x, y, c)
+			rgba.Set(x, y, c)
+		}
+	}
+
+	for _, gridColor := range []color.Color{color.NRGBA{0, 255, 255, 100}, color.RGBA{0, 0, 255, 255}} {
+		config := DefaultConfig()
+		config.GridColor = gridColor
+
+		fromNRGBA, err := RenderPixels(nrgba, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromRGBA, err := RenderPixels(rgba, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff, delta := imgridtest.CompareImages(fromNRGBA, fromRGBA); diff > 0 {
+			t.Errorf("GridColor %v: %d pixels differ (max delta %d)", gridColor, diff, delta)
+		}
+	}
+}
+
+func TestYCbCrAndCMYKSources(t *testing.T) {
+	bounds := image.Rect(0, 0, 250, 150)
+	ycbcr := image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i] = uint8(3 * i)
+		ycbcr.Cr[i] = uint8(255 - i)
+	}
+	cmyk := image.NewCMYK(bounds)
+	for i := range cmyk.Pix {
+		cmyk.Pix[i] = uint8(7 * i)
+	}
+
+	for name, src := range map[string]image.Image{"YCbCr": ycbcr, "CMYK": cmyk} {
+		out, err := RenderPixels(src, DefaultConfig())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if out.Bounds() != bounds {
+			t.Errorf("%s: bounds %v, want %v", name, out.Bounds(), bounds)
+		}
+
+		// Pixels away from the lines and numbers keep the source colors
+		for y := 5; y < 30; y++ {
+			for x := 5; x < 30; x++ {
+				want := color.RGBAModel.Convert(src.At(x, y)).(color.RGBA)
+				if got := out.RGBAAt(x, y); got != want {
+					t.Fatalf("%s: pixel (%d, %d) = %v, want %v", name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSeamlessTiling(t *testing.T) {
+	blue := color.RGBA{0, 0, 255, 255}
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	config := DefaultConfig()
+	config.Seamless = true
+	config.CanvasColor = color.White
+	config.GridColor = blue
+	config.NumberBG = color.Transparent
+	config.NumberColor = color.Transparent
+
+	out, err := RenderPixels(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tile a 2x2 copy of the output
+	tiled := image.NewRGBA(image.Rect(0, 0, 600, 400))
+	for _, offset := range []image.Point{{0, 0}, {300, 0}, {0, 200}, {300, 200}} {
+		draw.Draw(tiled, out.Bounds().Add(offset), out, image.Point{}, draw.Src)
+	}
+
+	// Every line keeps its 2 pixel width across the seams: the line on the boundary at 300
+	// covers pixels 299 and 300 like the one at 100 covers 99 and 100
+	onLine := func(p int) bool { return p%100 == 99 || p%100 == 0 }
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 600; x++ {
+			want := onLine(x) || onLine(y)
+			if got := tiled.RGBAAt(x, y) == blue; got != want {
+				t.Fatalf("tiled pixel (%d, %d): line %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// labelCenter returns the center of the bounding box of the pixels of out that equal c within
+// r.
+func labelCenter(out *image.RGBA, r image.Rectangle, c color.RGBA) (image.Point, bool) {
+	box := image.Rectangle{}
+	found := false
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if out.RGBAAt(x, y) != c {
+				continue
+			}
+			p := image.Rect(x, y, x+1, y+1)
+			if !found {
+				box, found = p, true
+			}
+			box = box.Union(p)
+		}
+	}
+
+	return image.Pt((box.Min.X+box.Max.X)/2, (box.Min.Y+box.Max.Y)/2), found
+}
+
+func TestCellLargerThanImage(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		name          string
+		width, height int
+		want          image.Point // Center of cell 0's label
+	}{
+		{"wider cell", 120, 300, image.Pt(60, 100)},
+		{"taller cell", 300, 120, image.Pt(100, 60)},
+		{"both", 120, 80, image.Pt(60, 40)},
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.CellSize = 200
+		config.CanvasColor = color.White
+		config.GridColor = color.Transparent
+		config.NumberBG = red
+		config.NumberColor = red
+
+		out, err := RenderPixels(image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := labelCenter(out, image.Rect(0, 0, min(tt.width, 200), min(tt.height, 200)), red)
+		if !ok {
+			t.Errorf("%s: no label drawn for cell 0", tt.name)
+			continue
+		}
+		if d := got.Sub(tt.want); d.X < -1 || d.X > 1 || d.Y < -1 || d.Y > 1 {
+			t.Errorf("%s: label centered at %v, want %v", tt.name, got, tt.want)
+		}
+
+		x, y, err := CellToPixel(0, tt.width, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.width < 200 && x != tt.width/2 {
+			t.Errorf("%s: CellToPixel(0) x = %d, want %d", tt.name, x, tt.width/2)
+		}
+		if cell := PixelToCell(x, y, tt.width, 200); cell != 0 {
+			t.Errorf("%s: PixelToCell(%d, %d) = %d, want 0", tt.name, x, y, cell)
+		}
+		for _, p := range []image.Point{{0, 0}, {min(tt.width, 200) - 1, min(tt.height, 200) - 1}} {
+			if cell := PixelToCell(p.X, p.Y, tt.width, 200); cell != 0 {
+				t.Errorf("%s: PixelToCell(%d, %d) = %d, want 0", tt.name, p.X, p.Y, cell)
+			}
+		}
+	}
+}
+
+func TestCloseGridDivisibleWidth(t *testing.T) {
+	blue := color.RGBA{0, 0, 255, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	for _, closeGrid := range []bool{false, true} {
+		config := DefaultConfig()
+		config.CloseGrid = closeGrid
+		config.CanvasColor = white
+		config.GridColor = blue
+		config.NumberBG = color.Transparent
+		config.NumberColor = color.Transparent
+
+		// 300 is a multiple of CellSize, so the right edge is a cell boundary
+		out, err := RenderPixels(image.NewRGBA(image.Rect(0, 0, 300, 200)), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := white
+		if closeGrid {
+			want = blue
+		}
+		for _, p := range []image.Point{{298, 50}, {299, 50}, {50, 198}, {50, 199}} {
+			if got := out.RGBAAt(p.X, p.Y); got != want {
+				t.Errorf("CloseGrid %v: edge pixel %v = %v, want %v", closeGrid, p, got, want)
+			}
+		}
+	}
+}
+
+func TestColumnRounding650(t *testing.T) {
+	// 650 pixels with CellSize 100: 6 full columns and a 50 pixel partial one
+	tests := []struct {
+		rounding ColumnRounding
+		columns  int
+		cell6    image.Point // Center of cell 6
+	}{
+		{FloorColumns, 6, image.Pt(50, 150)},
+		{CeilColumns, 7, image.Pt(625, 50)},
+	}
+
+	for _, tt := range tests {
+		if got := columnsPerRow(650, 100, tt.rounding); got != tt.columns {
+			t.Errorf("rounding %d: %d columns, want %d", tt.rounding, got, tt.columns)
+		}
+
+		x, y, err := CellToPixelRounding(6, 650, 100, tt.rounding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := image.Pt(x, y); got != tt.cell6 {
+			t.Errorf("rounding %d: cell 6 at %v, want %v", tt.rounding, got, tt.cell6)
+		}
+
+		for cell := 0; cell < 3*tt.columns; cell++ {
+			x, y, err := CellToPixelRounding(cell, 650, 100, tt.rounding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := PixelToCellRounding(x, y, 650, 100, tt.rounding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != cell {
+				t.Errorf("rounding %d: cell %d maps to pixel (%d, %d), which maps back to cell %d", tt.rounding, cell, x, y, got)
+			}
+		}
+	}
+}
+
+func TestResetPerRow(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	config := DefaultConfig()
+	config.ResetPerRow = true
+
+	for cell, want := range []string{"0", "1", "2", "0", "1", "2"} {
+		if got := CellLabel(cell, cell%3, cell/3, config); got != want {
+			t.Errorf("CellLabel(%d) = %q, want %q", cell, got, want)
+		}
+	}
+
+	// The drawn labels restart in the second row as if labeled explicitly
+	reset, err := RenderPixels(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit := DefaultConfig()
+	explicit.CellLabels = map[int]string{3: "0", 4: "1", 5: "2"}
+	want, err := RenderPixels(img, explicit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff, _ := imgridtest.CompareImages(reset, want); diff > 0 {
+		t.Errorf("%d pixels differ from explicitly restarted labels", diff)
+	}
+
+	// Coordinates keep using the flat index
+	x, y, err := CellToPixel(4, 300, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x != 150 || y != 150 {
+		t.Errorf("CellToPixel(4) = (%d, %d), want (150, 150)", x, y)
+	}
+	if got := PixelToCell(x, y, 300, 100); got != 4 {
+		t.Errorf("PixelToCell(%d, %d) = %d, want 4", x, y, got)
+	}
+}
+
+func TestExcludeCells(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	config := DefaultConfig()
+	config.CanvasColor = color.White
+	config.GridColor = color.Transparent
+	config.NumberBG = red
+	config.ExcludeCells = map[int]bool{1: true, 5: true}
+
+	out, err := RenderPixels(image.NewRGBA(image.Rect(0, 0, 300, 200)), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for cell := 0; cell < 6; cell++ {
+		r := image.Rect(0, 0, 100, 100).Add(image.Pt(cell%3*100, cell/3*100))
+		_, labeled := labelCenter(out, r, red)
+		if labeled == config.ExcludeCells[cell] {
+			t.Errorf("cell %d: labeled %v, excluded %v", cell, labeled, config.ExcludeCells[cell])
+		}
+	}
+}
+
+func TestMirror(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		mirrorX, mirrorY bool
+		origin           NumberOrigin
+		cell0            image.Point // Center of the cell holding cell 0
+	}{
+		{false, false, TopLeft, image.Pt(50, 50)},
+		{true, false, TopRight, image.Pt(250, 50)},
+		{false, true, BottomLeft, image.Pt(50, 150)},
+		{true, true, BottomRight, image.Pt(250, 150)},
+	}
+
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.MirrorX = tt.mirrorX
+		config.MirrorY = tt.mirrorY
+		config.CanvasColor = color.White
+		config.GridColor = color.Transparent
+		config.NumberBG = red
+		config.ExcludeCells = map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true}
+
+		if got := config.Origin(); got != tt.origin {
+			t.Errorf("MirrorX %v, MirrorY %v: origin %d, want %d", tt.mirrorX, tt.mirrorY, got, tt.origin)
+		}
+
+		// Only cell 0 is labeled, so the label shows where it is drawn
+		out, err := RenderPixels(image.NewRGBA(image.Rect(0, 0, 300, 200)), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := labelCenter(out, out.Bounds(), red)
+		if d := got.Sub(tt.cell0); !ok || d.X < -1 || d.X > 1 || d.Y < -1 || d.Y > 1 {
+			t.Errorf("MirrorX %v, MirrorY %v: cell 0 label at %v, want %v", tt.mirrorX, tt.mirrorY, got, tt.cell0)
+		}
+
+		for cell := 0; cell < 6; cell++ {
+			x, y, err := CellToPixelOrigin(cell, 300, 200, 100, config.Origin())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cell == 0 && image.Pt(x, y) != tt.cell0 {
+				t.Errorf("MirrorX %v, MirrorY %v: CellToPixelOrigin(0) = (%d, %d), want %v", tt.mirrorX, tt.mirrorY, x, y, tt.cell0)
+			}
+			back, err := PixelToCellOrigin(x, y, 300, 200, 100, config.Origin())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if back != cell {
+				t.Errorf("MirrorX %v, MirrorY %v: cell %d maps back to cell %d", tt.mirrorX, tt.mirrorY, cell, back)
+			}
+		}
+	}
+}
+
+func TestCanvasPadSubImage(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	full := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(full, image.Rect(50, 50, 250, 150), &image.Uniform{red}, image.Point{}, draw.Src)
+	sub := full.SubImage(image.Rect(50, 50, 250, 150))
+
+	config := DefaultConfig()
+	config.CanvasPad = 5
+	config.CanvasColor = color.White
+	out, err := RenderPixels(sub, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width, height := OutputDimensions(200, 100, config)
+	if got := out.Bounds().Size(); got != image.Pt(width, height) {
+		t.Fatalf("output size %v, want %dx%d", got, width, height)
+	}
+
+	// The source starts right after the pad; away from the lines its pixels are unchanged
+	if got := out.RGBAAt(4, 20); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pad pixel = %v, want white", got)
+	}
+	if got := out.RGBAAt(10, 20); got != red {
+		t.Errorf("source pixel = %v, want %v", got, red)
+	}
+	if got := out.RGBAAt(204, 104); got != red {
+		t.Errorf("last source pixel = %v, want %v", got, red)
+	}
+}
+
+func TestAddGridCustomLinesCanvasPad(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	config := DefaultConfig()
+	config.CanvasPad = 20
+	config.CanvasColor = color.White
+
+	custom, err := AddGridCustomLines(img, []int{100, 200, 300}, []int{100, 200}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid, err := AddGrid(img, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{"AddGridCustomLines": custom, "AddGrid": grid} {
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decoded.Bounds().Size(); got != image.Pt(340, 240) {
+			t.Errorf("%s: output size %v, want 340x240", name, got)
+		}
+	}
+}
+
+func TestDrawLabelNilNumberColor(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	dst := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	config := DefaultConfig()
+	config.NumberColor = nil
+	config.NumberBG = red
+
+	DrawLabel(dst, 50, 50, "12", config)
+
+	// The background is drawn without glyphs on top of it
+	if got := dst.RGBAAt(50, 50); got != red {
+		t.Errorf("label center = %v, want %v", got, red)
+	}
+}
+
+func TestNormalizedToCellInvalidCellSize(t *testing.T) {
+	for _, cellSize := range []int{0, -10} {
+		if _, err := NormalizedToCell(0.5, 0.5, 300, 200, cellSize); err == nil {
+			t.Errorf("NormalizedToCell with cell size %d: expected error, got nil", cellSize)
+		}
+	}
+}
+
+func TestPixelToCellRoundingInvalidCellSize(t *testing.T) {
+	for _, rounding := range []ColumnRounding{FloorColumns, CeilColumns, MergeColumns} {
+		if _, err := PixelToCellRounding(10, 10, 650, 0, rounding); err == nil {
+			t.Errorf("rounding %d with cell size 0: expected error, got nil", rounding)
+		}
+	}
+}
+
+func TestGridMaskBinary(t *testing.T) {
+	config := DefaultConfig()
+	config.SubDivisions = 4
+	config.CenterMarker = MarkerCircle
+	config.MarkerColor = color.RGBA{255, 0, 0, 255}
+	config.CornerNumbers = true
+	config.DrawAxes = true
+	config.AxesOrigin = image.Pt(150, 100)
+	config.CellOpacity = func(cell, col, row int) float64 { return 0.5 }
+	config.EdgeFade = true
+	config.AutoContrastNumbers = true
+	config.DrawDiagonals = true
+
+	data, err := GridMask(300, 200, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gray, ok := mask.(*image.Gray)
+	if !ok {
+		t.Fatalf("mask is %T, want *image.Gray", mask)
+	}
+	values := map[uint8]int{}
+	for _, v := range gray.Pix {
+		values[v]++
+	}
+	for v := range values {
+		if v != 0 && v != 255 {
+			t.Errorf("mask holds gray value %d in %d pixels", v, values[v])
+		}
+	}
+	if values[255] == 0 {
+		t.Error("mask has no white pixels")
+	}
+}
+
+func TestLabelOperationsMatchesMeasuring(t *testing.T) {
+	configs := map[string]func(*Config){
+		"default":    func(c *Config) {},
+		"LabelEvery": func(c *Config) { c.LabelEvery = 3 },
+		"ResetPerRow": func(c *Config) {
+			c.ResetPerRow = true
+			c.LabelEvery = 4
+		},
+		"ExcludeCells": func(c *Config) { c.ExcludeCells = map[int]bool{0: true, 15: true, 99: false, 5000: true} },
+		"CellLabels":   func(c *Config) { c.CellLabels = map[int]string{3: "ENTRANCE", 120: "", 7: "A"} },
+		"Prefix": func(c *Config) {
+			c.NumberPrefix = "#"
+			c.WrapLabelAt = 2
+		},
+	}
+
+	for name, setup := range configs {
+		config := DefaultConfig()
+		config.CellSize = 7
+		setup(&config)
+		columns, rows := 23, 11
+
+		// Measure every label like rendering does
+		var want int64
+		for cell := 0; cell < columns*rows; cell++ {
+			if !shouldLabel(cell, config) {
+				continue
+			}
+			width, height := MeasureLabel(CellLabel(cell, cell%columns, cell/columns, config), config)
+			want += 2 * int64(width) * int64(height)
+		}
+
+		if got := labelOperations(columns, rows, config); got != want {
+			t.Errorf("%s: %d label operations, want %d", name, got, want)
+		}
+	}
+}
+
+func TestRotateEntryPoints(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	red := color.RGBA{255, 0, 0, 255}
+	draw.Draw(img, img.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	config := DefaultConfig()
+	config.Rotate = 90
+
+	// Mask the left half, which ends up as the top half of the rotated output
+	mask := image.NewAlpha(img.Bounds())
+	draw.Draw(mask, image.Rect(0, 0, 150, 200), image.Opaque, image.Point{}, draw.Src)
+
+	calls := map[string]func() ([]byte, error){
+		"HighlightCell":      func() ([]byte, error) { return HighlightCell(img, 0, red, config) },
+		"SpotlightCell":      func() ([]byte, error) { return SpotlightCell(img, 0, red, config) },
+		"AddGridMasked":      func() ([]byte, error) { return AddGridMasked(img, mask, config) },
+		"AddGridCustomLines": func() ([]byte, error) { return AddGridCustomLines(img, []int{100}, []int{50}, config) },
+		"AddGridClippedPolygon": func() ([]byte, error) {
+			return AddGridClippedPolygon(img, []image.Point{{0, 0}, {300, 0}, {300, 200}}, config)
+		},
+	}
+	for name, call := range calls {
+		data, err := call()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+		if size := decoded.Bounds().Size(); size != image.Pt(200, 300) {
+			t.Errorf("%s: expected 200x300, got %dx%d", name, size.X, size.Y)
+		}
+		if name == "AddGridMasked" {
+			for y := 0; y < 150; y++ {
+				for x := 0; x < 200; x++ {
+					if c := color.RGBAModel.Convert(decoded.At(x, y)); c != red {
+						t.Fatalf("AddGridMasked: pixel (%d, %d) = %v, expected the masked source", x, y, c)
+					}
+				}
+			}
+		}
+	}
+
+	data, err := AddGridSweepGIF(img, []int{0, 1}, red, 10, config)
+	if err != nil {
+		t.Fatalf("AddGridSweepGIF: %v", err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("AddGridSweepGIF: decode: %v", err)
+	}
+	for i, frame := range anim.Image {
+		if size := frame.Bounds().Size(); size != image.Pt(200, 300) {
+			t.Errorf("AddGridSweepGIF: frame %d: expected 200x300, got %dx%d", i, size.X, size.Y)
+		}
+	}
+
+	if err := AddGridReuse(image.NewRGBA(img.Bounds()), img, config); err == nil {
+		t.Error("AddGridReuse: expected error for a nonzero Rotate, got nil")
+	}
+}
+
+func TestAddGridMaskedNilMask(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	if _, err := AddGridMasked(img, nil, DefaultConfig()); err == nil {
+		t.Error("expected error for a nil mask, got nil")
+	}
+}
+
+func TestSaveConfigHexColors(t *testing.T) {
+	config := DefaultConfig()
+	config.GridColor = color.NRGBA{0, 255, 255, 100}
+	config.CellBackgrounds = map[int]color.Color{3: color.NRGBA{255, 0, 0, 128}}
+
+	var buf bytes.Buffer
+	if err := SaveConfig(&buf, config); err != nil {
+		t.Fatal(err)
+	}
+	for _, hex := range []string{`"#00FFFF64"`, `"#FF000080"`} {
+		if !bytes.Contains(buf.Bytes(), []byte(hex)) {
+			t.Errorf("expected %s in preset:\n%s", hex, buf.String())
+		}
+	}
+
+	loaded, err := LoadConfig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GridColor != config.GridColor {
+		t.Errorf("GridColor: expected %v, got %v", config.GridColor, loaded.GridColor)
+	}
+	if got := loaded.CellBackgrounds[3]; got != config.CellBackgrounds[3] {
+		t.Errorf("CellBackgrounds[3]: expected %v, got %v", config.CellBackgrounds[3], got)
+	}
+
+	// DefaultConfig's grid color is not valid premultiplied and must not overflow
+	buf.Reset()
+	if err := SaveConfig(&buf, DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`"GridColor": "#00FFFF64"`)) {
+		t.Errorf("expected the default grid color as #00FFFF64:\n%s", buf.String())
+	}
+
+	if _, err := LoadConfig(bytes.NewReader([]byte(`{"GridColor": "cyan"}`))); err == nil {
+		t.Error("expected error for an invalid hex color, got nil")
+	}
+}
@@ -0,0 +1,57 @@
+// Package imgridtest provides helpers for testing code that renders grids with imgrid.
+// Comparing decoded pixels instead of encoded bytes keeps golden-image tests stable
+// across changes in Go's PNG encoder.
+package imgridtest
+
+import "image"
+
+// CompareImages compares two images pixel by pixel, aligning them at their top-left corners.
+// It returns the number of pixels that differ in any channel and the largest per-channel
+// difference found, measured in 8-bit units on alpha-premultiplied values. If the images
+// differ in size, pixels covered by only one of them count as different with a delta of 255.
+func CompareImages(a, b image.Image) (diffPixels int, maxDelta uint8) {
+	ab, bb := a.Bounds(), b.Bounds()
+	width := max(ab.Dx(), bb.Dx())
+	height := max(ab.Dy(), bb.Dy())
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pa := image.Pt(ab.Min.X+x, ab.Min.Y+y)
+			pb := image.Pt(bb.Min.X+x, bb.Min.Y+y)
+			if !pa.In(ab) || !pb.In(bb) {
+				diffPixels++
+				maxDelta = 255
+				continue
+			}
+
+			ar, ag, abl, aa := a.At(pa.X, pa.Y).RGBA()
+			br, bg, bbl, ba := b.At(pb.X, pb.Y).RGBA()
+
+			var delta uint8
+			for _, d := range []uint8{
+				channelDelta(ar, br),
+				channelDelta(ag, bg),
+				channelDelta(abl, bbl),
+				channelDelta(aa, ba),
+			} {
+				delta = max(delta, d)
+			}
+
+			if delta > 0 {
+				diffPixels++
+				maxDelta = max(maxDelta, delta)
+			}
+		}
+	}
+
+	return diffPixels, maxDelta
+}
+
+// channelDelta returns the absolute difference of two 16-bit channel values in 8-bit units.
+func channelDelta(a, b uint32) uint8 {
+	a, b = a>>8, b>>8
+	if a > b {
+		return uint8(a - b)
+	}
+	return uint8(b - a)
+}
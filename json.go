@@ -0,0 +1,249 @@
+package imgrid
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// plainConfig has the fields of Config without its JSON methods.
+type plainConfig Config
+
+// configJSON is the JSON form of a Config. Its color fields replace those of Config so that
+// encoding/json can round-trip them: colors are stored as alpha-premultiplied color.RGBA values
+// and nil colors are omitted. Every color field of Config must be listed here.
+type configJSON struct {
+	plainConfig
+
+	GridColor         *color.RGBA `json:",omitempty"`
+	NumberColor       *color.RGBA `json:",omitempty"`
+	NumberBG          *color.RGBA `json:",omitempty"`
+	NumberShadowColor *color.RGBA `json:",omitempty"`
+	CornerDotColor    *color.RGBA `json:",omitempty"`
+	CanvasColor       *color.RGBA `json:",omitempty"`
+	MarkerColor       *color.RGBA `json:",omitempty"`
+	SubDivisionColor  *color.RGBA `json:",omitempty"`
+	AxesColor         *color.RGBA `json:",omitempty"`
+
+	CellBackgrounds map[int]*color.RGBA `json:",omitempty"`
+}
+
+// MarshalJSON encodes the configuration as a JSON object keyed by field name. Colors are
+// written as color.RGBA objects ({"R":0,"G":255,"B":255,"A":100}) and nil colors are left out.
+// Encoder, Hooks and CellOpacity hold functions and LinePattern holds an image; they cannot be
+// serialized, so they are always left out.
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(configJSON{
+		plainConfig:       plainConfig(c),
+		GridColor:         toRGBA(c.GridColor),
+		NumberColor:       toRGBA(c.NumberColor),
+		NumberBG:          toRGBA(c.NumberBG),
+		NumberShadowColor: toRGBA(c.NumberShadowColor),
+		CornerDotColor:    toRGBA(c.CornerDotColor),
+		CanvasColor:       toRGBA(c.CanvasColor),
+		MarkerColor:       toRGBA(c.MarkerColor),
+		SubDivisionColor:  toRGBA(c.SubDivisionColor),
+		AxesColor:         toRGBA(c.AxesColor),
+		CellBackgrounds:   toRGBAMap(c.CellBackgrounds),
+	})
+}
+
+// UnmarshalJSON decodes a configuration written by MarshalJSON. Fields missing from data keep
+// their current values, so decoding into DefaultConfig() fills in defaults for them.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	aux := configJSON{plainConfig: plainConfig(*c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*c = Config(aux.plainConfig)
+	fromRGBA(&c.GridColor, aux.GridColor)
+	fromRGBA(&c.NumberColor, aux.NumberColor)
+	fromRGBA(&c.NumberBG, aux.NumberBG)
+	fromRGBA(&c.NumberShadowColor, aux.NumberShadowColor)
+	fromRGBA(&c.CornerDotColor, aux.CornerDotColor)
+	fromRGBA(&c.CanvasColor, aux.CanvasColor)
+	fromRGBA(&c.MarkerColor, aux.MarkerColor)
+	fromRGBA(&c.SubDivisionColor, aux.SubDivisionColor)
+	fromRGBA(&c.AxesColor, aux.AxesColor)
+	if aux.CellBackgrounds != nil {
+		c.CellBackgrounds = fromRGBAMap(aux.CellBackgrounds)
+	}
+	return nil
+}
+
+// presetJSON is the form of a Config in preset files. It is like configJSON, but colors are
+// stored as "#RRGGBBAA" hex strings with straight alpha, as read by ParseHexColor, so presets
+// are easy to edit by hand. Every color field of Config must be listed here.
+type presetJSON struct {
+	plainConfig
+
+	GridColor         string `json:",omitempty"`
+	NumberColor       string `json:",omitempty"`
+	NumberBG          string `json:",omitempty"`
+	NumberShadowColor string `json:",omitempty"`
+	CornerDotColor    string `json:",omitempty"`
+	CanvasColor       string `json:",omitempty"`
+	MarkerColor       string `json:",omitempty"`
+	SubDivisionColor  string `json:",omitempty"`
+	AxesColor         string `json:",omitempty"`
+
+	CellBackgrounds map[int]string `json:",omitempty"`
+}
+
+// LoadConfig reads a preset written by SaveConfig, e.g. from a shared .imgrid file. Colors are
+// hex strings in any form ParseHexColor accepts. Fields missing from the preset take their
+// DefaultConfig values. The loaded configuration is validated, so a preset that AddGrid would
+// reject fails to load.
+func LoadConfig(r io.Reader) (Config, error) {
+	aux := presetJSON{plainConfig: plainConfig(DefaultConfig())}
+	if err := json.NewDecoder(r).Decode(&aux); err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	config := Config(aux.plainConfig)
+	for _, field := range []struct {
+		dst *color.Color
+		hex string
+	}{
+		{&config.GridColor, aux.GridColor},
+		{&config.NumberColor, aux.NumberColor},
+		{&config.NumberBG, aux.NumberBG},
+		{&config.NumberShadowColor, aux.NumberShadowColor},
+		{&config.CornerDotColor, aux.CornerDotColor},
+		{&config.CanvasColor, aux.CanvasColor},
+		{&config.MarkerColor, aux.MarkerColor},
+		{&config.SubDivisionColor, aux.SubDivisionColor},
+		{&config.AxesColor, aux.AxesColor},
+	} {
+		if err := fromHex(field.dst, field.hex); err != nil {
+			return Config{}, fmt.Errorf("failed to read config: %v", err)
+		}
+	}
+	if aux.CellBackgrounds != nil {
+		config.CellBackgrounds = make(map[int]color.Color, len(aux.CellBackgrounds))
+		for cell, hex := range aux.CellBackgrounds {
+			var c color.Color
+			if err := fromHex(&c, hex); err != nil {
+				return Config{}, fmt.Errorf("failed to read config: %v", err)
+			}
+			if c != nil {
+				config.CellBackgrounds[cell] = c
+			}
+		}
+	}
+	if err := validateConfig(config); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// SaveConfig writes c to w as an indented JSON preset that LoadConfig reads back. Fields are
+// keyed by name like in MarshalJSON, but colors are written as "#RRGGBBAA" hex strings. Encoder,
+// Hooks, CellOpacity and LinePattern cannot be serialized and are not saved.
+func SaveConfig(w io.Writer, c Config) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(presetJSON{
+		plainConfig:       plainConfig(c),
+		GridColor:         toHex(c.GridColor),
+		NumberColor:       toHex(c.NumberColor),
+		NumberBG:          toHex(c.NumberBG),
+		NumberShadowColor: toHex(c.NumberShadowColor),
+		CornerDotColor:    toHex(c.CornerDotColor),
+		CanvasColor:       toHex(c.CanvasColor),
+		MarkerColor:       toHex(c.MarkerColor),
+		SubDivisionColor:  toHex(c.SubDivisionColor),
+		AxesColor:         toHex(c.AxesColor),
+		CellBackgrounds:   toHexMap(c.CellBackgrounds),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+
+	return nil
+}
+
+// toHex formats c as a "#RRGGBBAA" hex string with straight alpha, returning "" for a nil color.
+// Channels are clamped to the alpha before unpremultiplying, so a color.RGBA literal that is
+// not valid premultiplied, like DefaultConfig's color.RGBA{0, 255, 255, 100}, is saved as the
+// color it was meant to be ("#00FFFF64") instead of overflowing.
+func toHex(c color.Color) string {
+	if c == nil {
+		return ""
+	}
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return "#00000000"
+	}
+	straight := func(v uint32) uint32 {
+		return min(v, a) * 0xffff / a >> 8
+	}
+	return fmt.Sprintf("#%02X%02X%02X%02X", straight(r), straight(g), straight(b), a>>8)
+}
+
+// fromHex parses a hex color into dst unless it was missing from the input.
+func fromHex(dst *color.Color, hex string) error {
+	if hex == "" {
+		return nil
+	}
+	c, err := ParseHexColor(hex)
+	if err != nil {
+		return err
+	}
+	*dst = c
+	return nil
+}
+
+// toHexMap converts the colors of m like toHex, returning nil for an empty map.
+func toHexMap(m map[int]color.Color) map[int]string {
+	if len(m) == 0 {
+		return nil
+	}
+	hex := make(map[int]string, len(m))
+	for cell, c := range m {
+		hex[cell] = toHex(c)
+	}
+	return hex
+}
+
+// toRGBA converts c to a color.RGBA for serialization, returning nil for a nil color.
+func toRGBA(c color.Color) *color.RGBA {
+	if c == nil {
+		return nil
+	}
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	return &rgba
+}
+
+// fromRGBA stores a decoded color in dst unless it was missing from the input.
+func fromRGBA(dst *color.Color, c *color.RGBA) {
+	if c != nil {
+		*dst = *c
+	}
+}
+
+// toRGBAMap converts the colors of m like toRGBA, returning nil for an empty map.
+func toRGBAMap(m map[int]color.Color) map[int]*color.RGBA {
+	if len(m) == 0 {
+		return nil
+	}
+	rgba := make(map[int]*color.RGBA, len(m))
+	for cell, c := range m {
+		rgba[cell] = toRGBA(c)
+	}
+	return rgba
+}
+
+// fromRGBAMap converts decoded colors back to a color map, leaving out null entries.
+func fromRGBAMap(m map[int]*color.RGBA) map[int]color.Color {
+	colors := make(map[int]color.Color, len(m))
+	for cell, c := range m {
+		if c != nil {
+			colors[cell] = *c
+		}
+	}
+	return colors
+}
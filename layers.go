@@ -0,0 +1,51 @@
+package imgrid
+
+import "image"
+
+// AddGridLayers renders the gridded image as three separate, aligned layers for compositing
+// in an external editor: the base image (the source on its canvas, as AddGrid would draw on
+// it), the grid lines on a transparent background and the cell numbers and markers on a
+// transparent background. Stacking lines and then numbers over the base reproduces AddGrid's
+// output up to rounding. All three layers have the size of AddGrid's output, including
+// CanvasPad and Rotate. AutoContrastNumbers is ignored because the numbers are drawn without
+// the content below them. Returns the layers as PNG bytes.
+func AddGridLayers(img image.Image, config Config) (base, lines, numbers []byte, err error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, nil, nil, err
+	}
+	if config, err = normalizeConfig(config); err != nil {
+		return nil, nil, nil, err
+	}
+	config.AutoContrastNumbers = false
+
+	canvas := newCanvas(img, config)
+	bounds := canvas.Bounds()
+
+	lineLayer := image.NewRGBA(bounds)
+	drawGridLines(lineLayer, bounds, config)
+
+	// Upright numbers on a rotated grid are drawn at the rotated positions of their cells,
+	// as in drawRotatedGrid
+	numberLayer := image.NewRGBA(bounds)
+	if config.Rotate == 0 || config.RotateNumbers {
+		drawGridNumbers(numberLayer, bounds, config, nil, nil)
+		numberLayer = rotateImage(numberLayer, config.Rotate)
+	} else {
+		numberLayer = rotateImage(numberLayer, config.Rotate)
+		drawGridNumbers(numberLayer, bounds, config, nil, func(x, y int) (int, int) {
+			return rotatePoint(x, y, bounds, config.Rotate)
+		})
+	}
+
+	if base, err = encodeImage(rotateImage(canvas, config.Rotate), config); err != nil {
+		return nil, nil, nil, err
+	}
+	if lines, err = encodeImage(rotateImage(lineLayer, config.Rotate), config); err != nil {
+		return nil, nil, nil, err
+	}
+	if numbers, err = encodeImage(numberLayer, config); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return base, lines, numbers, nil
+}
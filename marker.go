@@ -0,0 +1,78 @@
+package imgrid
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// MarkerStyle selects the shape drawn at each cell center when Config.CenterMarker is set.
+type MarkerStyle int
+
+const (
+	// MarkerNone draws no marker.
+	MarkerNone MarkerStyle = iota
+	// MarkerDot draws a filled disc.
+	MarkerDot
+	// MarkerCircle draws a ring LineWidth pixels thick.
+	MarkerCircle
+	// MarkerCross draws a plus sign with arms LineWidth pixels thick.
+	MarkerCross
+)
+
+// drawMarker draws the configured center marker centered on pixel (x, y) in MarkerColor.
+// MarkerSize is the marker's diameter in pixels. Discs and rings are anti-aliased by
+// compositing edge pixels with their partial coverage.
+func drawMarker(dst *image.RGBA, x, y int, config Config) {
+	if config.CenterMarker == MarkerNone || config.MarkerColor == nil || config.MarkerSize <= 0 {
+		return
+	}
+
+	radius := float64(config.MarkerSize) / 2
+	thickness := float64(config.LineWidth)
+	if thickness < 1 {
+		thickness = 1
+	}
+
+	// Pixel (x, y) is the marker center; sample coverage at pixel centers
+	cx, cy := float64(x)+0.5, float64(y)+0.5
+	reach := int(math.Ceil(radius + thickness))
+	area := image.Rect(x-reach, y-reach, x+reach+1, y+reach+1).Intersect(dst.Bounds())
+
+	for py := area.Min.Y; py < area.Max.Y; py++ {
+		for px := area.Min.X; px < area.Max.X; px++ {
+			var coverage float64
+			switch config.CenterMarker {
+			case MarkerDot:
+				d := math.Hypot(float64(px)+0.5-cx, float64(py)+0.5-cy)
+				coverage = radius + 0.5 - d
+			case MarkerCircle:
+				d := math.Hypot(float64(px)+0.5-cx, float64(py)+0.5-cy)
+				coverage = thickness/2 + 0.5 - math.Abs(d-(radius-thickness/2))
+			case MarkerCross:
+				// Axis-aligned bars need no anti-aliasing
+				dx, dy := math.Abs(float64(px)+0.5-cx), math.Abs(float64(py)+0.5-cy)
+				if (dx < thickness/2 && dy < radius) || (dy < thickness/2 && dx < radius) {
+					coverage = 1
+				}
+			}
+
+			if coverage >= 1 {
+				blendPixel(dst, px, py, config.MarkerColor)
+			} else if coverage > 0 {
+				blendPixel(dst, px, py, withCoverage(config.MarkerColor, coverage))
+			}
+		}
+	}
+}
+
+// withCoverage returns c with its opacity scaled by coverage in [0, 1].
+func withCoverage(c color.Color, coverage float64) color.Color {
+	r, g, b, a := c.RGBA()
+	return color.RGBA64{
+		R: uint16(float64(r) * coverage),
+		G: uint16(float64(g) * coverage),
+		B: uint16(float64(b) * coverage),
+		A: uint16(float64(a) * coverage),
+	}
+}
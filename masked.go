@@ -0,0 +1,51 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+)
+
+// AddGridMasked overlays a numbered grid on img like AddGrid, but knocks out grid lines and
+// numbers wherever mask is more than half opaque, leaving the source visible there. The mask is
+// sampled at source image coordinates, so a subject cut-out with the same bounds as img keeps the
+// subject unobstructed. Pixels outside the mask's bounds are not knocked out, and a nil mask is
+// an error. The result is rotated like in AddGrid when Rotate is set. Returns the modified image
+// as PNG bytes.
+func AddGridMasked(img image.Image, mask image.Image, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if mask == nil {
+		return nil, fmt.Errorf("mask must not be nil")
+	}
+
+	base := newCanvas(img, config)
+	overlay := image.NewRGBA(base.Bounds())
+	copy(overlay.Pix, base.Pix)
+	gridded := drawRotatedGrid(overlay, config, nil)
+
+	// Restore the source wherever the mask covers it
+	offset := image.Pt(config.CanvasPad, config.CanvasPad)
+	maskBounds := mask.Bounds().Add(offset).Intersect(base.Bounds())
+	for y := maskBounds.Min.Y; y < maskBounds.Max.Y; y++ {
+		for x := maskBounds.Min.X; x < maskBounds.Max.X; x++ {
+			if _, _, _, a := mask.At(x-offset.X, y-offset.Y).RGBA(); a > 0x7fff {
+				restorePixel(gridded, base, x, y, config.Rotate)
+			}
+		}
+	}
+
+	return encodeGridded(gridded, img, config)
+}
+
+// restorePixel copies pixel (x, y) of base to where it ended up in gridded, the grid drawn
+// over a copy of base and rotated clockwise by degrees.
+func restorePixel(gridded, base *image.RGBA, x, y, degrees int) {
+	rx, ry := rotatePoint(x, y, base.Bounds(), degrees)
+	i, j := gridded.PixOffset(rx+gridded.Rect.Min.X, ry+gridded.Rect.Min.Y), base.PixOffset(x, y)
+	copy(gridded.Pix[i:i+4], base.Pix[j:j+4])
+}
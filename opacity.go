@@ -0,0 +1,62 @@
+package imgrid
+
+import (
+	"image"
+	"image/color"
+)
+
+// cellOpacity returns the CellOpacity of the cell at grid position (gridX, gridY) of a grid
+// numbered with columns x rows cells, clamped to [0, 1]. Positions past the last numbered
+// column or row, such as merged partial cells, belong to the cell before them.
+func cellOpacity(gridX, gridY, columns, rows int, config Config) float64 {
+	if config.CellOpacity == nil {
+		return 1
+	}
+
+	cell := cellNumberAt(min(gridX, columns-1), min(gridY, rows-1), columns, rows, config.Origin())
+	return min(max(config.CellOpacity(cell, cell%columns, cell/columns), 0), 1)
+}
+
+// fadeCells scales the line mask of a width x height grid by the CellOpacity of the cell each
+// pixel lies in. CellOpacity is called once per cell that overlaps the mask.
+func fadeCells(mask *image.Alpha, width, height int, config Config) {
+	columns, rows := numberedDimensions(width, height, config)
+	bounds := mask.Bounds().Intersect(image.Rect(0, 0, width, height))
+	if bounds.Empty() {
+		return
+	}
+
+	for gridY := bounds.Min.Y / config.CellSize; gridY*config.CellSize < bounds.Max.Y; gridY++ {
+		for gridX := bounds.Min.X / config.CellSize; gridX*config.CellSize < bounds.Max.X; gridX++ {
+			opacity := cellOpacity(gridX, gridY, columns, rows, config)
+			if opacity == 1 {
+				continue
+			}
+
+			cell := image.Rect(gridX*config.CellSize, gridY*config.CellSize, (gridX+1)*config.CellSize, (gridY+1)*config.CellSize)
+			cell = cell.Intersect(bounds)
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				row := mask.Pix[mask.PixOffset(cell.Min.X, y):mask.PixOffset(cell.Max.X, y)]
+				for i, a := range row {
+					row[i] = uint8(float64(a)*opacity + 0.5)
+				}
+			}
+		}
+	}
+}
+
+// fadeCell returns config with the colors drawn for a cell's number, marker and corner dot
+// scaled by opacity.
+func fadeCell(config Config, opacity float64) Config {
+	if opacity == 1 {
+		return config
+	}
+
+	config = fadeLabel(config, opacity)
+	for _, c := range []*color.Color{&config.MarkerColor, &config.CornerDotColor} {
+		if *c != nil {
+			*c = withCoverage(*c, opacity)
+		}
+	}
+	return config
+}
@@ -0,0 +1,61 @@
+package imgrid
+
+import "image"
+
+// labelBoxes records the boxes of the labels drawn so far for SkipOverlappingLabels. Boxes
+// are bucketed by the square of bucket pixels they touch, so checking a new box only scans
+// the boxes near it.
+type labelBoxes struct {
+	bucket  int
+	buckets map[image.Point][]image.Rectangle
+}
+
+// newLabelBoxes returns an empty labelBoxes with buckets of the given size, which should be
+// about the size of a label.
+func newLabelBoxes(bucket int) *labelBoxes {
+	return &labelBoxes{bucket: max(bucket, 1), buckets: make(map[image.Point][]image.Rectangle)}
+}
+
+// add records r unless it overlaps a recorded box, and reports whether it was recorded.
+func (b *labelBoxes) add(r image.Rectangle) bool {
+	keys := b.keys(r)
+	for _, key := range keys {
+		for _, box := range b.buckets[key] {
+			if box.Overlaps(r) {
+				return false
+			}
+		}
+	}
+
+	for _, key := range keys {
+		b.buckets[key] = append(b.buckets[key], r)
+	}
+	return true
+}
+
+// keys returns the buckets r touches.
+func (b *labelBoxes) keys(r image.Rectangle) []image.Point {
+	var keys []image.Point
+	for y := floorDiv(r.Min.Y, b.bucket); y <= floorDiv(r.Max.Y-1, b.bucket); y++ {
+		for x := floorDiv(r.Min.X, b.bucket); x <= floorDiv(r.Max.X-1, b.bucket); x++ {
+			keys = append(keys, image.Pt(x, y))
+		}
+	}
+
+	return keys
+}
+
+// floorDiv returns a / b rounded toward negative infinity, for b > 0.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
+}
+
+// labelBox returns the box DrawLabel covers when drawing text centered at (x, y).
+func labelBox(x, y int, text string, config Config) image.Rectangle {
+	width, height := MeasureLabel(text, config)
+	return image.Rect(x-width/2, y-height/2, x-width/2+width, y-height/2+height)
+}
@@ -0,0 +1,42 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// PrecomputeOverlay renders the grid lines and numbers for a width x height image onto a
+// layer filled with CanvasColor (transparent when nil), so the grid can be drawn once and
+// composited onto many images of that size with ApplyOverlay, e.g. the frames of a video.
+// The result matches AddGrid up to rounding. Settings that depend on the image
+// (AutoContrastNumbers, CanvasPad and Rotate) are ignored.
+func PrecomputeOverlay(width, height int, config Config) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid overlay size: %dx%d", width, height)
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.AutoContrastNumbers = false
+	overlay := image.NewRGBA(image.Rect(0, 0, width, height))
+	if config.CanvasColor != nil {
+		draw.Draw(overlay, overlay.Bounds(), &image.Uniform{config.CanvasColor}, image.Point{}, draw.Src)
+	}
+	drawGrid(overlay, config)
+
+	return overlay, nil
+}
+
+// ApplyOverlay composites an overlay from PrecomputeOverlay onto frame in place. The overlay's
+// top-left corner is placed at frame's. Returns an error if the two differ in size.
+func ApplyOverlay(frame, overlay *image.RGBA) error {
+	if frame.Bounds().Size() != overlay.Bounds().Size() {
+		return fmt.Errorf("overlay size %v does not match frame size %v", overlay.Bounds().Size(), frame.Bounds().Size())
+	}
+
+	compositeImage(frame, overlay, frame.Bounds(), overlay.Bounds().Min)
+	return nil
+}
@@ -0,0 +1,51 @@
+package imgrid
+
+import "image"
+
+// compositeLines composites the grid lines marked in mask over dst in GridColor, or filled
+// with LinePattern when that is set.
+func compositeLines(dst *image.RGBA, mask *image.Alpha, config Config) {
+	if config.LinePattern == nil {
+		compositeMask(dst, mask, config.GridColor)
+		return
+	}
+
+	compositePattern(dst, mask, config.LinePattern)
+}
+
+// compositePattern composites pattern over dst wherever mask is non-zero, scaling the
+// pattern's coverage by the mask's alpha. The pattern is tiled from dst's origin: pixel (x, y)
+// takes the color of the pattern pixel at (x mod w, y mod h) from the pattern's top-left
+// corner, where w x h is the pattern's size.
+func compositePattern(dst *image.RGBA, mask *image.Alpha, pattern image.Image) {
+	tile := copyImage(pattern)
+	size := tile.Bounds().Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+
+	bounds := dst.Bounds().Intersect(mask.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ty := tile.Bounds().Min.Y + ((y%size.Y)+size.Y)%size.Y
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			m := uint32(mask.AlphaAt(x, y).A) * 0x101
+			if m == 0 {
+				continue
+			}
+
+			tx := tile.Bounds().Min.X + ((x%size.X)+size.X)%size.X
+			j := tile.PixOffset(tx, ty)
+			src := tile.Pix[j : j+4 : j+4]
+			sa := uint32(src[3]) * 0x101 * m / 0xffff
+			if sa == 0 {
+				continue
+			}
+
+			i := dst.PixOffset(x, y)
+			pix := dst.Pix[i : i+4 : i+4]
+			r, g, b, a := over(uint32(src[0])*0x101*m/0xffff, uint32(src[1])*0x101*m/0xffff, uint32(src[2])*0x101*m/0xffff, sa,
+				uint32(pix[0])*0x101, uint32(pix[1])*0x101, uint32(pix[2])*0x101, uint32(pix[3])*0x101)
+			pix[0], pix[1], pix[2], pix[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+		}
+	}
+}
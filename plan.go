@@ -0,0 +1,151 @@
+package imgrid
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GridPlan describes the predicted cost of rendering a grid, as computed by PlanGrid.
+type GridPlan struct {
+	Columns int // Number of cell columns, including a partial column at the right edge unless merged
+	Rows    int // Number of cell rows, including a partial row at the bottom edge unless merged
+	Cells   int // Total number of cells (Columns * Rows)
+
+	OutputWidth  int // Width of the rendered image in pixels
+	OutputHeight int // Height of the rendered image in pixels
+
+	Operations  int64 // Rough number of per-pixel draw operations
+	MemoryBytes int64 // Rough peak memory used by the render buffers, excluding the encoded output
+}
+
+// PlanGrid predicts the cost of rendering a grid on a width x height image without drawing
+// anything. Handlers can use it to reject or queue expensive renders. The operation and
+// memory figures are estimates meant for comparison, not exact counts.
+func PlanGrid(width, height int, config Config) (GridPlan, error) {
+	if width <= 0 || height <= 0 {
+		return GridPlan{}, fmt.Errorf("invalid image size: %dx%d", width, height)
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return GridPlan{}, err
+	}
+
+	outWidth, outHeight := OutputDimensions(width, height, config)
+
+	// The grid is drawn on the padded canvas before any rotation
+	width += 2 * config.CanvasPad
+	height += 2 * config.CanvasPad
+
+	columns, rows := numberedDimensions(width, height, config)
+	plan := GridPlan{
+		Columns:      columns,
+		Rows:         rows,
+		Cells:        columns * rows,
+		OutputWidth:  outWidth,
+		OutputHeight: outHeight,
+	}
+
+	pixels := int64(width) * int64(height)
+
+	// Copying the source and compositing the line mask each touch every pixel once
+	plan.Operations = 2 * pixels
+	plan.Operations += int64(columns-1) * int64(height) * int64(config.LineWidth)
+	plan.Operations += int64(rows-1) * int64(width) * int64(config.LineWidth)
+
+	if !config.HideNumbers {
+		plan.Operations += labelOperations(columns, rows, config)
+	}
+
+	// RGBA overlay plus the 8-bit line mask
+	plan.MemoryBytes = 4*pixels + pixels
+
+	// Rotation copies every pixel into a second RGBA buffer
+	if config.Rotate != 0 {
+		plan.Operations += pixels
+		plan.MemoryBytes += 4 * pixels
+	}
+
+	return plan, nil
+}
+
+// labelOperations estimates the draw operations of the labels of a columns x rows grid: each
+// label fills its background box and draws at most as many glyph pixels again. Labels of
+// numbers with the same count of digits have the same size, so instead of measuring every
+// label, cells are counted per digit count and multiplied by the size of one label of that
+// group. Custom and excluded labels are corrected for one by one.
+func labelOperations(columns, rows int, config Config) int64 {
+	plain := config
+	plain.CellLabels = nil
+
+	// ops returns the operations of the label of number n, cached per digit count
+	sizes := map[int]int64{}
+	ops := func(n int) int64 {
+		digits := len(strconv.Itoa(n))
+		if size, ok := sizes[digits]; ok {
+			return size
+		}
+		width, height := MeasureLabel(CellLabel(n, n, 0, plain), plain)
+		sizes[digits] = 2 * int64(width) * int64(height)
+		return sizes[digits]
+	}
+	number := func(cell int) int {
+		if config.ResetPerRow {
+			return cell % columns
+		}
+		return cell
+	}
+
+	// Cells are numbered in runs: one per row with ResetPerRow, otherwise one for the grid
+	runs, length := 1, columns*rows
+	if config.ResetPerRow {
+		runs, length = rows, columns
+	}
+
+	var total int64
+	for run := 0; run < runs; run++ {
+		start := run * length
+		for low := 0; low < length; low = max(10*low, 10) {
+			high := min(max(10*low, 10), length)
+			total += int64(labeledCount(start+low, start+high, config.LabelEvery)) * ops(low)
+		}
+	}
+
+	// Excluded cells draw nothing and custom labels have their own size
+	for cell := range config.ExcludeCells {
+		if cell >= 0 && cell < columns*rows && config.ExcludeCells[cell] && labeledCount(cell, cell+1, config.LabelEvery) == 1 {
+			total -= ops(number(cell))
+		}
+	}
+	for cell, label := range config.CellLabels {
+		if cell >= 0 && cell < columns*rows && shouldLabel(cell, config) {
+			width, height := MeasureLabel(label, config)
+			total += 2*int64(width)*int64(height) - ops(number(cell))
+		}
+	}
+
+	return total
+}
+
+// labeledCount returns how many of the cells in [from, to) LabelEvery labels, ignoring
+// ExcludeCells.
+func labeledCount(from, to, every int) int {
+	if every <= 1 {
+		return to - from
+	}
+
+	// Multiples of every in [from, to)
+	return (to+every-1)/every - (from+every-1)/every
+}
+
+// OutputDimensions returns the pixel dimensions of the image AddGrid produces for an input of
+// the given size. The output matches the input unless CanvasPad enlarges the canvas, in which
+// case both dimensions grow by twice the pad, or Rotate is 90 or 270, which swaps them.
+func OutputDimensions(inputWidth, inputHeight int, config Config) (outWidth, outHeight int) {
+	outWidth = inputWidth + 2*config.CanvasPad
+	outHeight = inputHeight + 2*config.CanvasPad
+	if config.Rotate == 90 || config.Rotate == 270 {
+		outWidth, outHeight = outHeight, outWidth
+	}
+
+	return outWidth, outHeight
+}
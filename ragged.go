@@ -0,0 +1,204 @@
+package imgrid
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddGridCustomLines overlays a non-uniform grid on the provided image. Vertical lines are drawn
+// at the x positions in xLines and horizontal lines at the y positions in yLines, using the same
+// line style as AddGrid. The resulting cells are numbered row-major and labeled at their centers;
+// config.CellSize is ignored. The canvas is built like in AddGrid, honoring CanvasPad and
+// CanvasColor, and positions are measured on it, so with a pad they include the pad. Positions
+// must be strictly increasing and lie inside the canvas. The result is rotated like in AddGrid
+// when Rotate is set. Returns the modified image as PNG bytes.
+func AddGridCustomLines(img image.Image, xLines, yLines []int, config Config) ([]byte, error) {
+	if err := checkImageSize(img); err != nil {
+		return nil, err
+	}
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	overlay := newCanvas(img, config)
+	width, height := overlay.Bounds().Max.X, overlay.Bounds().Max.Y
+	if err := validateLinePositions(xLines, width, "x"); err != nil {
+		return nil, err
+	}
+	if err := validateLinePositions(yLines, height, "y"); err != nil {
+		return nil, err
+	}
+
+	lines := image.NewAlpha(overlay.Bounds())
+	markLines(lines, xLines, yLines, width, height, config)
+	compositeLines(overlay, lines, config)
+
+	// Numbers turn with the image only when RotateNumbers is set; otherwise they are drawn
+	// upright at the rotated positions of their cells
+	bounds := overlay.Bounds()
+	upright := config.Rotate != 0 && !config.RotateNumbers
+	if upright {
+		overlay = rotate(overlay, config)
+	}
+
+	// Number the cells between consecutive edges
+	xEdges := cellEdges(xLines, width)
+	yEdges := cellEdges(yLines, height)
+	cellNumber := 0
+	for row := 0; row < len(yEdges)-1; row++ {
+		for col := 0; col < len(xEdges)-1; col++ {
+			centerX := (xEdges[col] + xEdges[col+1]) / 2
+			centerY := (yEdges[row] + yEdges[row+1]) / 2
+			if upright {
+				centerX, centerY = rotatePoint(centerX, centerY, bounds, config.Rotate)
+			}
+			if !config.HideNumbers && shouldLabel(cellNumber, config) {
+				DrawLabel(overlay, centerX, centerY, CellLabel(cellNumber, col, row, config), config)
+			}
+			cellNumber++
+		}
+	}
+
+	if !upright {
+		overlay = rotate(overlay, config)
+	}
+
+	return encodeGridded(overlay, img, config)
+}
+
+// AddGridFromPositionsCSV overlays a non-uniform grid like AddGridCustomLines, reading the line
+// positions from csvData, e.g. as exported by a survey tool. The first row is a header naming an
+// "x" column, a "y" column or both (in any order, case-insensitive; other columns are ignored),
+// and every following row holds an x position, a y position or both; empty fields are skipped. Positions
+// may be listed in any order and repeated, and are sorted before drawing. The resulting cells are
+// numbered row-major. Returns the modified image as PNG bytes.
+func AddGridFromPositionsCSV(img image.Image, csvData []byte, config Config) ([]byte, error) {
+	xLines, yLines, err := parseLinePositions(csvData)
+	if err != nil {
+		return nil, err
+	}
+
+	return AddGridCustomLines(img, xLines, yLines, config)
+}
+
+// parseLinePositions reads the x and y line positions of a CSV in the format described at
+// AddGridFromPositionsCSV, sorted and without duplicates.
+func parseLinePositions(csvData []byte) (xLines, yLines []int, err error) {
+	r := csv.NewReader(bytes.NewReader(csvData))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read line positions CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("line positions CSV has no header")
+	}
+
+	xColumn, yColumn := -1, -1
+	for i, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "x":
+			xColumn = i
+		case "y":
+			yColumn = i
+		}
+	}
+	if xColumn < 0 && yColumn < 0 {
+		return nil, nil, fmt.Errorf("line positions CSV header must name an x or a y column: %q", records[0])
+	}
+
+	for line, record := range records[1:] {
+		for _, column := range []struct {
+			index     int
+			positions *[]int
+		}{{xColumn, &xLines}, {yColumn, &yLines}} {
+			if column.index < 0 || column.index >= len(record) || strings.TrimSpace(record[column.index]) == "" {
+				continue
+			}
+			p, err := strconv.Atoi(strings.TrimSpace(record[column.index]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid line position on row %d: %q", line+2, record[column.index])
+			}
+			*column.positions = append(*column.positions, p)
+		}
+	}
+
+	return sortedUnique(xLines), sortedUnique(yLines), nil
+}
+
+// sortedUnique sorts positions in place and drops repeated values.
+func sortedUnique(positions []int) []int {
+	sort.Ints(positions)
+	unique := positions[:0]
+	for _, p := range positions {
+		if len(unique) == 0 || p != unique[len(unique)-1] {
+			unique = append(unique, p)
+		}
+	}
+	return unique
+}
+
+// CellToPixelCustom converts a cell number of a grid drawn by AddGridCustomLines to pixel
+// coordinates (center of the cell). The image size is needed to locate the last row and column.
+func CellToPixelCustom(cellNumber int, imageWidth, imageHeight int, xLines, yLines []int) (int, int, error) {
+	if err := validateLinePositions(xLines, imageWidth, "x"); err != nil {
+		return 0, 0, err
+	}
+	if err := validateLinePositions(yLines, imageHeight, "y"); err != nil {
+		return 0, 0, err
+	}
+
+	columns := len(xLines) + 1
+	rows := len(yLines) + 1
+	if cellNumber < 0 {
+		return 0, 0, fmt.Errorf("%w: %d", ErrNegativeCell, cellNumber)
+	}
+	if cellNumber >= columns*rows {
+		return 0, 0, fmt.Errorf("%w: %d not in [0, %d)", ErrCellOutOfRange, cellNumber, columns*rows)
+	}
+
+	xEdges := cellEdges(xLines, imageWidth)
+	yEdges := cellEdges(yLines, imageHeight)
+	col := cellNumber % columns
+	row := cellNumber / columns
+
+	return (xEdges[col] + xEdges[col+1]) / 2, (yEdges[row] + yEdges[row+1]) / 2, nil
+}
+
+// PixelToCellCustom converts pixel coordinates to the number of the cell containing them in a
+// grid drawn by AddGridCustomLines. A line position belongs to the cell that starts there.
+// xLines and yLines must be sorted in increasing order.
+func PixelToCellCustom(x, y int, xLines, yLines []int) int {
+	col := sort.SearchInts(xLines, x+1)
+	row := sort.SearchInts(yLines, y+1)
+
+	return row*(len(xLines)+1) + col
+}
+
+// validateLinePositions checks that positions are strictly increasing and inside (0, length).
+func validateLinePositions(positions []int, length int, axis string) error {
+	for i, p := range positions {
+		if p <= 0 || p >= length {
+			return fmt.Errorf("%s line position %d outside image (0, %d)", axis, p, length)
+		}
+		if i > 0 && p <= positions[i-1] {
+			return fmt.Errorf("%s line positions must be strictly increasing: %d after %d", axis, p, positions[i-1])
+		}
+	}
+	return nil
+}
+
+// cellEdges returns the cell boundaries along one axis: 0, the line positions, and length.
+func cellEdges(positions []int, length int) []int {
+	edges := make([]int, 0, len(positions)+2)
+	edges = append(edges, 0)
+	edges = append(edges, positions...)
+	return append(edges, length)
+}
@@ -0,0 +1,105 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+)
+
+// rulerTickLength returns how far ruler ticks reach into the image from its edge.
+func rulerTickLength(config Config) int {
+	return max(config.CellSize/4, 2*config.LineWidth)
+}
+
+// tickRects returns the pixel rectangles of the ruler ticks drawn in RulerMode: one tick at
+// every cell boundary along the top and left edges of a width x height grid, placed across
+// the boundary like a grid line. Rectangles are clipped to clip.
+func tickRects(width, height int, clip image.Rectangle, config Config) []image.Rectangle {
+	visible := image.Rect(0, 0, width, height).Intersect(clip)
+	lead := lineLead(config)
+	length := rulerTickLength(config)
+
+	var rects []image.Rectangle
+	add := func(r image.Rectangle) {
+		if r = r.Intersect(visible); !r.Empty() {
+			rects = append(rects, r)
+		}
+	}
+	for x := 0; x < width; x += config.CellSize {
+		add(image.Rect(x-lead, 0, x-lead+config.LineWidth, length))
+	}
+	for y := 0; y < height; y += config.CellSize {
+		add(image.Rect(0, y-lead, length, y-lead+config.LineWidth))
+	}
+
+	return rects
+}
+
+// drawRulerLabels labels the ruler ticks of a width x height grid with their pixel positions:
+// below the ticks along the top edge and to the right of the ticks along the left edge. The
+// origin is labeled once, on the top ruler. Labels are nudged inward so they stay on the
+// image, and LabelEvery labels only every LabelEvery-th tick. place maps grid coordinates to
+// dst coordinates as in drawGridNumbers.
+func drawRulerLabels(dst *image.RGBA, width, height int, config Config, place func(x, y int) (int, int)) {
+	if config.HideNumbers {
+		return
+	}
+
+	gap := config.LineWidth + config.NumberScale
+	offset := rulerTickLength(config) + gap
+	every := max(config.LabelEvery, 1)
+
+	for i, x := 0, 0; x < width; i, x = i+1, x+config.CellSize {
+		if i%every != 0 {
+			continue
+		}
+		label := fmt.Sprintf("%d", x)
+		labelWidth, labelHeight := MeasureLabel(label, config)
+		centerX := min(max(x, labelWidth/2), width-(labelWidth+1)/2)
+		px, py := place(centerX, offset+labelHeight/2)
+		DrawLabel(dst, px, py, label, config)
+	}
+
+	for i, y := 1, config.CellSize; y < height; i, y = i+1, y+config.CellSize {
+		if i%every != 0 {
+			continue
+		}
+		label := fmt.Sprintf("%d", y)
+		labelWidth, labelHeight := MeasureLabel(label, config)
+		centerY := y
+		if config.AxisLabelRotation != 0 {
+			// Turned labels are tall enough to reach past the top edge
+			labelWidth, labelHeight = labelHeight, labelWidth
+			centerY = max(centerY, labelHeight/2)
+		}
+		centerY = min(centerY, height-(labelHeight+1)/2)
+		px, py := place(offset+labelWidth/2, centerY)
+		drawTurnedLabel(dst, px, py, label, config.AxisLabelRotation, config)
+	}
+}
+
+// drawTurnedLabel draws a label like DrawLabel, centered at (x, y), but turned counterclockwise
+// by degrees (0, 90 or 270).
+func drawTurnedLabel(dst *image.RGBA, x, y int, text string, degrees int, config Config) {
+	if degrees == 0 {
+		DrawLabel(dst, x, y, text, config)
+		return
+	}
+
+	labelWidth, labelHeight := MeasureLabel(text, config)
+	if config.AutoContrastNumbers {
+		region := image.Rect(x-labelHeight/2, y-labelWidth/2, x-labelHeight/2+labelHeight, y-labelWidth/2+labelWidth)
+		config.NumberColor, config.NumberBG = contrastColors(dst, region, config.NumberBG)
+		config.AutoContrastNumbers = false
+	}
+
+	// Draw upright on a transparent layer with room for shadows and bold strokes, then turn
+	// the layer and composite it centered on the same point
+	margin := max(config.NumberWeight, 0) + config.NumberScale
+	layer := image.NewRGBA(image.Rect(0, 0, labelWidth, labelHeight).Inset(-margin))
+	DrawLabel(layer, labelWidth/2, labelHeight/2, text, config)
+	turned := rotateImage(layer, 360-degrees)
+
+	size := turned.Bounds().Size()
+	r := image.Rect(0, 0, size.X, size.Y).Add(image.Pt(x-size.X/2, y-size.Y/2))
+	compositeImage(dst, turned, r, image.Point{})
+}
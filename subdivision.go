@@ -0,0 +1,53 @@
+package imgrid
+
+import (
+	"image"
+	"image/draw"
+)
+
+// drawSubDivisions draws the minor lines that split every cell of a width x height grid into
+// SubDivisions equal parts along both axes onto overlay. Minor lines are one pixel wide and
+// drawn in SubDivisionColor, or in GridColor at 40% opacity when that is nil. Pixels covered
+// by the grid lines in majors are left out, so the grid lines drawn afterwards do not blend
+// with them.
+func drawSubDivisions(overlay *image.RGBA, width, height int, majors []image.Rectangle, config Config) {
+	minorColor := config.SubDivisionColor
+	if minorColor == nil {
+		minorColor = withCoverage(config.GridColor, 0.4)
+	}
+
+	bounds := overlay.Bounds()
+	xs := subDivisionPositions(width, bounds.Min.X, bounds.Max.X, config)
+	ys := subDivisionPositions(height, bounds.Min.Y, bounds.Max.Y, config)
+
+	minor := config
+	minor.LineWidth = 1
+	minor.CloseGrid = false
+
+	lines := image.NewAlpha(bounds)
+	for _, r := range lineRects(xs, ys, width, height, bounds, minor) {
+		draw.Draw(lines, r, image.Opaque, image.Point{}, draw.Src)
+	}
+	for _, r := range majors {
+		draw.Draw(lines, r, image.Transparent, image.Point{}, draw.Src)
+	}
+	compositeMask(overlay, lines, minorColor)
+}
+
+// subDivisionPositions returns the positions of the minor lines inside the cells along an axis
+// of the given length, SubDivisions-1 per cell at evenly spaced offsets from the cell's start.
+// Only positions in [lo, hi) are returned.
+func subDivisionPositions(length, lo, hi int, config Config) []int {
+	end := min(length, hi)
+
+	var positions []int
+	for start := max(lo, 0) / config.CellSize * config.CellSize; start < end; start += config.CellSize {
+		for i := 1; i < config.SubDivisions; i++ {
+			if p := start + i*config.CellSize/config.SubDivisions; p >= lo && p < end {
+				positions = append(positions, p)
+			}
+		}
+	}
+
+	return positions
+}
@@ -0,0 +1,70 @@
+package imgrid
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// GridTile renders one tileSize x tileSize tile of a transparent fullWidth x fullHeight gridded
+// image, for deep-zoom viewers that request tiles on demand. Tiles are addressed by their
+// column tileX and row tileY. Only the grid lines, numbers and markers that reach the tile are
+// drawn, so the cost depends on the tile size rather than the full image; numbers centered in
+// neighboring tiles still appear where they overlap this one. cellSize replaces config.CellSize.
+// Parts of edge tiles beyond the full image stay transparent. CanvasPad and Rotate are ignored.
+// Returns the tile as PNG bytes.
+func GridTile(fullWidth, fullHeight, cellSize, tileX, tileY, tileSize int, config Config) ([]byte, error) {
+	config = config.Normalize()
+	config.CellSize = cellSize
+	if err := validateConfig(config); err != nil {
+		return nil, err
+	}
+	if fullWidth <= 0 || fullHeight <= 0 {
+		return nil, fmt.Errorf("invalid image size: %dx%d", fullWidth, fullHeight)
+	}
+	if tileSize <= 0 {
+		return nil, fmt.Errorf("invalid tile size: %d", tileSize)
+	}
+
+	full := image.Rect(0, 0, fullWidth, fullHeight)
+	tile := image.Rect(tileX*tileSize, tileY*tileSize, (tileX+1)*tileSize, (tileY+1)*tileSize)
+	visible := tile.Intersect(full)
+	if tileX < 0 || tileY < 0 || visible.Empty() {
+		return nil, fmt.Errorf("tile (%d, %d) outside the %dx%d image", tileX, tileY, fullWidth, fullHeight)
+	}
+
+	// Draw in full-image coordinates on a canvas covering just the visible part of the tile
+	work := image.NewRGBA(visible)
+	drawGridLines(work, full, config)
+	drawGridNumbers(work, full, config, nil, nil)
+
+	out := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+	draw.Draw(out, visible.Sub(tile.Min), work, visible.Min, draw.Src)
+
+	return encodeImage(out, config)
+}
+
+// ForEachTile renders every tile of a fullWidth x fullHeight grid overlay with GridTile, row
+// by row, and passes each to fn along with its tile column and row. Only one tile is held at a
+// time, so whole deep-zoom pyramid levels can be generated with bounded memory. Iteration stops
+// at the first error, which is returned as is when it comes from fn.
+func ForEachTile(fullWidth, fullHeight, cellSize, tileSize int, config Config, fn func(tx, ty int, png []byte) error) error {
+	if tileSize <= 0 {
+		return fmt.Errorf("invalid tile size: %d", tileSize)
+	}
+
+	columns, rows := gridDimensions(fullWidth, fullHeight, tileSize)
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < columns; tx++ {
+			data, err := GridTile(fullWidth, fullHeight, cellSize, tx, ty, tileSize, config)
+			if err != nil {
+				return err
+			}
+			if err := fn(tx, ty, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}